@@ -0,0 +1,272 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+//Job status values
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobAborted   = "aborted"
+)
+
+//Job triggers. What made the agent run a job
+const (
+	TriggerAPI      = "api"
+	TriggerSchedule = "schedule"
+)
+
+const maxQueuedJobs = 100
+
+//ErrQueueFull the agent has too many queued jobs to accept another
+var ErrQueueFull = errors.New("Too many queued jobs")
+
+//BuildRequest a Banaifile and what to run from it
+type BuildRequest struct {
+	Script      string            `json:"script"`                //Content of the Banaifile
+	Targets     []string          `json:"targets,omitempty"`     //Targets to run. Default is main
+	SecretsFile string            `json:"secretsFile,omitempty"` //Path of a secrets file on the agent machine
+	Env         map[string]string `json:"env,omitempty"`         //Environment variables added to the build
+	Params      map[string]string `json:"params,omitempty"`      //Parameters of the build, as given by -p on the command line
+	DryRun      bool              `json:"dryRun,omitempty"`      //Log the calls with side effects instead of running them
+}
+
+//BuildFunc runs the build in workDir and writes its output to out. It returns the value the build ended with.
+//The build should stop when abort is closed
+type BuildFunc func(req BuildRequest, workDir string, out io.Writer, abort <-chan struct{}) (string, error)
+
+//Job a build request sent to the agent and its state
+type Job struct {
+	ID       string       `json:"id"`
+	Request  BuildRequest `json:"request"`
+	Trigger  string       `json:"trigger"`
+	Status   string       `json:"status"`
+	Value    string       `json:"value,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Created  time.Time    `json:"created"`
+	Started  time.Time    `json:"started,omitempty"`
+	Ended    time.Time    `json:"ended,omitempty"`
+	WorkDir  string       `json:"workDir,omitempty"`
+	log      *jobLog
+	abort    chan struct{}
+	aborting bool
+}
+
+//Agent accepts build jobs and runs them one after the other
+type Agent struct {
+	Logger *logrus.Logger
+
+	workspace string
+	build     BuildFunc
+	queue     chan *Job
+	history   *History
+
+	mutex         sync.Mutex
+	jobs          map[string]*Job
+	webhooks      map[string]Webhook
+	webhookSecret SecretFunc
+	token         string        //Bearer token the API requires
+	secretsDir    string        //Folder of the secrets files jobs can name
+	retention     time.Duration //How long ended jobs are kept
+}
+
+//New create an agent that runs jobs, each in its own folder under workspace
+func New(workspace string, build BuildFunc) (*Agent, error) {
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create agent workspace %s, %s", abs, err)
+	}
+	history, err := OpenHistory(HistoryFolder(abs))
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{
+		Logger:    logrus.New(),
+		workspace: abs,
+		build:     build,
+		queue:     make(chan *Job, maxQueuedJobs),
+		history:   history,
+		jobs:      make(map[string]*Job),
+	}, nil
+}
+
+//Submit queue a build request. The job is returned as soon as it is queued. The secrets file of the request is
+//resolved in the secrets folder of the agent
+func (a *Agent) Submit(req BuildRequest) (Job, error) {
+	if req.SecretsFile != "" {
+		file, err := a.resolveSecretsFile(req.SecretsFile)
+		if err != nil {
+			return Job{}, err
+		}
+		req.SecretsFile = file
+	}
+	return a.submit(req, TriggerAPI)
+}
+
+func (a *Agent) submit(req BuildRequest, trigger string) (Job, error) {
+	if req.Script == "" {
+		return Job{}, fmt.Errorf("Build request has no script")
+	}
+	job := &Job{
+		ID:      uuid.NewString(),
+		Request: req,
+		Trigger: trigger,
+		Status:  JobQueued,
+		Created: time.Now(),
+		log:     newJobLog(),
+		abort:   make(chan struct{}),
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	select {
+	case a.queue <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	a.jobs[job.ID] = job
+	a.Logger.Info("Job ", job.ID, " queued by ", trigger)
+	return *job, nil
+}
+
+//Job return a snapshot of a job
+func (a *Agent) Job(id string) (Job, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	job, ok := a.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+//Jobs return a snapshot of all jobs, oldest first
+func (a *Agent) Jobs() []Job {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	ret := make([]Job, 0, len(a.jobs))
+	for _, job := range a.jobs {
+		ret = append(ret, *job)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Created.Before(ret[j].Created) })
+	return ret
+}
+
+//Abort stop a queued or running job
+func (a *Agent) Abort(id string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	job, ok := a.jobs[id]
+	if !ok {
+		return fmt.Errorf("Job %s not found", id)
+	}
+	switch job.Status {
+	case JobQueued, JobRunning:
+		if !job.aborting {
+			job.aborting = true
+			close(job.abort)
+		}
+		return nil
+	}
+	return fmt.Errorf("Job %s already ended", id)
+}
+
+//Run runs queued jobs until the queue is closed. Jobs run one at a time, since a build changes the
+//working directory of the process
+func (a *Agent) Run() {
+	for job := range a.queue {
+		a.runJob(job)
+	}
+}
+
+func (a *Agent) runJob(job *Job) {
+	defer a.record(job)
+	defer job.log.close()
+
+	a.mutex.Lock()
+	if job.aborting {
+		job.Status = JobAborted
+		job.Ended = time.Now()
+		a.mutex.Unlock()
+		return
+	}
+	job.Status = JobRunning
+	job.Started = time.Now()
+	job.WorkDir = filepath.Join(a.workspace, job.ID)
+	a.mutex.Unlock()
+
+	a.Logger.Info("Job ", job.ID, " started")
+	var value string
+	var err = os.MkdirAll(job.WorkDir, 0755)
+	if err == nil {
+		value, err = a.build(job.Request, job.WorkDir, job.log, job.abort)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	job.Ended = time.Now()
+	job.Value = value
+	switch {
+	case job.aborting:
+		job.Status = JobAborted
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobSucceeded
+	}
+	a.Logger.Info("Job ", job.ID, " ended with status ", job.Status)
+}
+
+//record save a job that ended in the history
+func (a *Agent) record(job *Job) {
+	a.mutex.Lock()
+	run := Run{
+		ID:         job.ID,
+		ScriptHash: ScriptHash(job.Request.Script),
+		Targets:    job.Request.Targets,
+		Trigger:    job.Trigger,
+		Status:     job.Status,
+		Value:      job.Value,
+		Error:      job.Error,
+		Started:    job.Started,
+		Ended:      job.Ended,
+	}
+	a.mutex.Unlock()
+
+	if err := a.history.Save(run, job.log.Bytes()); err != nil {
+		a.Logger.Error("Failed to save job ", job.ID, " in history: ", err)
+	}
+}
+
+//History the history of the jobs the agent ran
+func (a *Agent) History() *History {
+	return a.history
+}
+
+//log return the log of the job
+func (a *Agent) log(id string) (*jobLog, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	job, ok := a.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return job.log, true
+}
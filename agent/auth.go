@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//RequireToken make every endpoint of the API require the bearer token token. The webhooks are the exception,
+//since git servers cannot send it. They are verified by the signature of their payload instead
+func (a *Agent) RequireToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("Agent API token is empty")
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.token = token
+	return nil
+}
+
+//authorize serve the requests to next only if they have the bearer token of the agent
+func (a *Agent) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mutex.Lock()
+		token := a.token
+		a.mutex.Unlock()
+
+		auth := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="banai"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("Missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//SecretsFolder the folder of the secrets files a job can name. Jobs cannot use secrets files outside of it, and
+//cannot name any if it is not set
+func (a *Agent) SecretsFolder(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return fmt.Errorf("Secrets folder %s is not a folder", abs)
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.secretsDir = abs
+	return nil
+}
+
+//resolveSecretsFile the path of the secrets file a job names, relative to the secrets folder
+func (a *Agent) resolveSecretsFile(name string) (string, error) {
+	a.mutex.Lock()
+	dir := a.secretsDir
+	a.mutex.Unlock()
+	if dir == "" {
+		return "", fmt.Errorf("Agent has no secrets folder, jobs cannot name a secrets file")
+	}
+
+	var file = filepath.Clean(name)
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	if rel, err := filepath.Rel(dir, file); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Secrets file %s is not in the secrets folder of the agent", name)
+	}
+	return file, nil
+}
+
+//KeepJobs how long jobs that ended are kept, with their folder, before they are deleted. Their run stays in
+//the history. 0 keeps them until the agent stops
+func (a *Agent) KeepJobs(retention time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.retention = retention
+}
+
+//pruneJobs delete the jobs that ended before the retention period, and their folders, every interval
+func (a *Agent) pruneJobs(interval time.Duration) {
+	for range time.Tick(interval) {
+		a.mutex.Lock()
+		retention := a.retention
+		var expired = make([]*Job, 0)
+		for id, job := range a.jobs {
+			if retention > 0 && !job.Ended.IsZero() && time.Since(job.Ended) > retention {
+				expired = append(expired, job)
+				delete(a.jobs, id)
+			}
+		}
+		a.mutex.Unlock()
+
+		for _, job := range expired {
+			if job.WorkDir != "" {
+				if err := os.RemoveAll(job.WorkDir); err != nil {
+					a.Logger.Error("Failed to delete folder of job ", job.ID, " ", err)
+				}
+			}
+			a.Logger.Info("Job ", job.ID, " deleted after its retention period")
+		}
+	}
+}
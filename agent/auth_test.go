@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	var tests = []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{name: "valid token", token: "s3cret", header: "Bearer s3cret", status: http.StatusOK},
+		{name: "no header", token: "s3cret", header: "", status: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cret", header: "Bearer other", status: http.StatusUnauthorized},
+		{name: "token prefix", token: "s3cret", header: "Bearer s3c", status: http.StatusUnauthorized},
+		{name: "not bearer", token: "s3cret", header: "Basic s3cret", status: http.StatusUnauthorized},
+		{name: "bare token", token: "s3cret", header: "s3cret", status: http.StatusUnauthorized},
+		{name: "agent without token", token: "", header: "Bearer ", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{token: tt.token}
+			handler := a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestRequireTokenEmpty(t *testing.T) {
+	if err := (&Agent{}).RequireToken(""); err == nil {
+		t.Errorf("RequireToken accepted an empty token")
+	}
+}
+
+func TestResolveSecretsFile(t *testing.T) {
+	dir := t.TempDir()
+	a := &Agent{}
+	if err := a.SecretsFolder(dir); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name string
+		file string
+		want string //Empty when the file is refused
+	}{
+		{name: "relative", file: "deploy.json", want: filepath.Join(dir, "deploy.json")},
+		{name: "sub folder", file: "prod/deploy.json", want: filepath.Join(dir, "prod", "deploy.json")},
+		{name: "absolute inside", file: filepath.Join(dir, "deploy.json"), want: filepath.Join(dir, "deploy.json")},
+		{name: "dot dot inside", file: "prod/../deploy.json", want: filepath.Join(dir, "deploy.json")},
+		{name: "parent", file: "../deploy.json"},
+		{name: "parent of sub folder", file: "prod/../../deploy.json"},
+		{name: "absolute outside", file: "/etc/passwd"},
+		{name: "the folder", file: "."},
+		{name: "name starting with dots", file: "..deploy.json", want: filepath.Join(dir, "..deploy.json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.resolveSecretsFile(tt.file)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("resolveSecretsFile(%q) = %q, want an error", tt.file, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveSecretsFile(%q) = %q, %v, want %q", tt.file, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretsFileWithoutFolder(t *testing.T) {
+	if _, err := (&Agent{}).resolveSecretsFile("deploy.json"); err == nil {
+		t.Errorf("a secrets file was resolved without a secrets folder")
+	}
+}
+
+func TestSecretsFolderMustExist(t *testing.T) {
+	if err := (&Agent{}).SecretsFolder(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("SecretsFolder accepted a missing folder")
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := (&Agent{}).SecretsFolder(file); err == nil {
+		t.Errorf("SecretsFolder accepted a file")
+	}
+}
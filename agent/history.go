@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	historyFolderName = "history"
+	runFileExt        = ".json"
+	runLogFileExt     = ".log"
+)
+
+//Run the record of a job that ended, as kept in the history
+type Run struct {
+	ID         string    `json:"id"`
+	ScriptHash string    `json:"scriptHash"` //sha256 of the Banaifile
+	Targets    []string  `json:"targets,omitempty"`
+	Trigger    string    `json:"trigger,omitempty"`
+	Status     string    `json:"status"`
+	Value      string    `json:"value,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Ended      time.Time `json:"ended"`
+}
+
+//RunQuery filter runs from the history. Empty fields match all runs
+type RunQuery struct {
+	Status string
+	Target string
+	Limit  int
+}
+
+//History keeps a record and the log of every run in a folder. Each run is saved in a json file
+//and a log file named by the run id
+type History struct {
+	folder string
+}
+
+//OpenHistory open the history kept in folder, creating the folder if needed
+func OpenHistory(folder string) (*History, error) {
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create history folder %s, %s", abs, err)
+	}
+	return &History{folder: abs}, nil
+}
+
+//HistoryFolder the folder the history of an agent is kept in
+func HistoryFolder(workspace string) string {
+	return filepath.Join(workspace, historyFolderName)
+}
+
+//ScriptHash the hash of a Banaifile as kept in the history
+func ScriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *History) runFile(id, ext string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("Invalid run id %s", id)
+	}
+	return filepath.Join(h.folder, id+ext), nil
+}
+
+//Save add a run and its log to the history
+func (h *History) Save(run Run, log []byte) error {
+	logFile, err := h.runFile(run.ID, runLogFileExt)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(logFile, log, 0644); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	runFile, _ := h.runFile(run.ID, runFileExt)
+	//Write the record last, so a listed run always has its log
+	tmpFile := runFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, runFile)
+}
+
+//Get a run by its id
+func (h *History) Get(id string) (Run, error) {
+	var run Run
+	runFile, err := h.runFile(id, runFileExt)
+	if err != nil {
+		return run, err
+	}
+	b, err := ioutil.ReadFile(runFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return run, fmt.Errorf("Run %s not found", id)
+		}
+		return run, err
+	}
+	err = json.Unmarshal(b, &run)
+	return run, err
+}
+
+//Log the captured log of a run
+func (h *History) Log(id string) ([]byte, error) {
+	logFile, err := h.runFile(id, runLogFileExt)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(logFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Run %s not found", id)
+	}
+	return b, err
+}
+
+//List the runs that match the query, latest first
+func (h *History) List(query RunQuery) ([]Run, error) {
+	files, err := ioutil.ReadDir(h.folder)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0)
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != runFileExt {
+			continue
+		}
+		run, err := h.Get(strings.TrimSuffix(f.Name(), runFileExt))
+		if err != nil {
+			continue
+		}
+		if query.Status != "" && run.Status != query.Status {
+			continue
+		}
+		if query.Target != "" && !containsString(run.Targets, query.Target) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	if query.Limit > 0 && len(runs) > query.Limit {
+		runs = runs[:query.Limit]
+	}
+	return runs, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+//jobLog collects the output of a job and lets readers follow it while the job is running
+type jobLog struct {
+	mutex   sync.Mutex
+	buf     []byte
+	closed  bool
+	changed chan struct{}
+}
+
+func newJobLog() *jobLog {
+	return &jobLog{changed: make(chan struct{})}
+}
+
+//Write append output to the log and wake up all readers waiting for it
+func (l *jobLog) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.buf = append(l.buf, p...)
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return len(p), nil
+}
+
+//close mark the log as complete. No more output is expected
+func (l *jobLog) close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.changed)
+	}
+}
+
+//Bytes a copy of the whole log
+func (l *jobLog) Bytes() []byte {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]byte{}, l.buf...)
+}
+
+//next return the output written after offset. If there is no such output, next waits until some is written,
+//the log is closed or ctx is done. complete is true when all output was read
+func (l *jobLog) next(ctx context.Context, offset int) (data []byte, complete bool) {
+	for {
+		l.mutex.Lock()
+		if offset < len(l.buf) {
+			data = append(data, l.buf[offset:]...)
+			l.mutex.Unlock()
+			return data, false
+		}
+		if l.closed {
+			l.mutex.Unlock()
+			return nil, true
+		}
+		changed := l.changed
+		l.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, true
+		}
+	}
+}
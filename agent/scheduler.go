@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sagiforbes/banai/utils/cronutils"
+)
+
+//Overlap policies. What to do when a scheduled run is due while the previous run of the same schedule did not end yet
+const (
+	OverlapSkip  = "skip"  //Do not run. This is the default
+	OverlapQueue = "queue" //Queue the run anyway
+)
+
+//Missed run policies. What to do with scheduled runs that were due while the agent was down
+const (
+	MissedSkip    = "skip"    //Wait for the next scheduled time. This is the default
+	MissedRunOnce = "runOnce" //Run once when the agent starts, no matter how many runs were missed
+)
+
+const scheduleStateFileName = "schedule-state.json"
+
+//ScheduleEntry a Banaifile target to run on a cron schedule
+type ScheduleEntry struct {
+	Cron        string   `json:"cron,omitempty"`
+	File        string   `json:"file"`
+	Targets     []string `json:"targets,omitempty"`
+	SecretsFile string   `json:"secretsFile,omitempty"`
+	Overlap     string   `json:"overlap,omitempty"`
+	Missed      string   `json:"missed,omitempty"`
+}
+
+//key identifies the entry in the schedule state, across agent restarts
+func (e ScheduleEntry) key() string {
+	return strings.Join([]string{e.Cron, e.File, strings.Join(e.Targets, ",")}, "|")
+}
+
+//ScheduleConfig content of a schedule config file. An entry without cron runs the schedules declared
+//in its Banaifile by the schedule() function
+type ScheduleConfig struct {
+	Schedules []ScheduleEntry `json:"schedules"`
+}
+
+//LoadScheduleConfig read a schedule config file. Relative file names in the config are relative to the config file folder
+func LoadScheduleConfig(fileName string) ([]ScheduleEntry, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var config ScheduleConfig
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("Failed to parse schedule config %s, %s", fileName, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Schedules {
+		e := &config.Schedules[i]
+		if e.File == "" {
+			return nil, fmt.Errorf("Schedule entry %d has no file", i)
+		}
+		if !filepath.IsAbs(e.File) {
+			e.File = filepath.Join(dir, e.File)
+		}
+		if e.SecretsFile != "" && !filepath.IsAbs(e.SecretsFile) {
+			e.SecretsFile = filepath.Join(dir, e.SecretsFile)
+		}
+	}
+	return config.Schedules, nil
+}
+
+type scheduledEntry struct {
+	ScheduleEntry
+	schedule  *cronutils.Schedule
+	next      time.Time
+	lastJobID string
+}
+
+//Schedule queue a job for every entry at the times set by its cron expression, as long as the agent runs
+func (a *Agent) Schedule(entries []ScheduleEntry) error {
+	scheduled := make([]*scheduledEntry, 0, len(entries))
+	for _, e := range entries {
+		s, err := cronutils.Parse(e.Cron)
+		if err != nil {
+			return fmt.Errorf("Schedule of %s: %s", e.File, err)
+		}
+		if err = scheduleFileExists(e); err != nil {
+			return err
+		}
+		switch e.Overlap {
+		case "":
+			e.Overlap = OverlapSkip
+		case OverlapSkip, OverlapQueue:
+		default:
+			return fmt.Errorf("Schedule of %s: unknown overlap policy %s", e.File, e.Overlap)
+		}
+		switch e.Missed {
+		case "":
+			e.Missed = MissedSkip
+		case MissedSkip, MissedRunOnce:
+		default:
+			return fmt.Errorf("Schedule of %s: unknown missed run policy %s", e.File, e.Missed)
+		}
+		scheduled = append(scheduled, &scheduledEntry{ScheduleEntry: e, schedule: s})
+	}
+
+	go a.runSchedule(scheduled)
+	return nil
+}
+
+func (a *Agent) loadScheduleState() map[string]time.Time {
+	state := make(map[string]time.Time)
+	b, err := ioutil.ReadFile(filepath.Join(a.workspace, scheduleStateFileName))
+	if err == nil {
+		json.Unmarshal(b, &state)
+	}
+	return state
+}
+
+func (a *Agent) saveScheduleState(state map[string]time.Time) {
+	b, _ := json.MarshalIndent(state, "", "  ")
+	if err := ioutil.WriteFile(filepath.Join(a.workspace, scheduleStateFileName), b, 0644); err != nil {
+		a.Logger.Error("Failed to save schedule state ", err)
+	}
+}
+
+func (a *Agent) runSchedule(entries []*scheduledEntry) {
+	state := a.loadScheduleState()
+	now := time.Now()
+	for _, e := range entries {
+		if last, ok := state[e.key()]; ok && e.Missed == MissedRunOnce {
+			if missed := e.schedule.Next(last); !missed.IsZero() && missed.Before(now) {
+				a.Logger.Info("Running missed scheduled run of ", e.File, " due at ", missed)
+				a.fire(e, missed, state)
+			}
+		}
+		e.next = e.schedule.Next(now)
+	}
+
+	for {
+		var next time.Time
+		for _, e := range entries {
+			if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+				next = e.next
+			}
+		}
+		if next.IsZero() {
+			return
+		}
+
+		time.Sleep(time.Until(next))
+
+		now = time.Now()
+		for _, e := range entries {
+			if !e.next.IsZero() && !e.next.After(now) {
+				a.fire(e, e.next, state)
+				e.next = e.schedule.Next(now)
+			}
+		}
+	}
+}
+
+//fire queue the job of a scheduled entry that was due at dueTime
+func (a *Agent) fire(e *scheduledEntry, dueTime time.Time, state map[string]time.Time) {
+	state[e.key()] = dueTime
+	defer a.saveScheduleState(state)
+
+	if e.Overlap == OverlapSkip && e.lastJobID != "" {
+		if job, ok := a.Job(e.lastJobID); ok && (job.Status == JobQueued || job.Status == JobRunning) {
+			a.Logger.Warn("Skip scheduled run of ", e.File, " ", e.Targets, ", previous run ", job.ID, " is still ", job.Status)
+			return
+		}
+	}
+
+	script, err := ioutil.ReadFile(e.File)
+	if err != nil {
+		a.Logger.Error("Failed to read scheduled Banaifile ", err)
+		return
+	}
+	job, err := a.submit(BuildRequest{
+		Script:      string(script),
+		Targets:     e.Targets,
+		SecretsFile: e.SecretsFile,
+	}, TriggerSchedule)
+	if err != nil {
+		a.Logger.Error("Failed to queue scheduled run of ", e.File, " ", err)
+		return
+	}
+	e.lastJobID = job.ID
+}
+
+//scheduleFileExists check that a Banaifile of a schedule entry exists
+func scheduleFileExists(e ScheduleEntry) error {
+	if _, err := os.Stat(e.File); err != nil {
+		return fmt.Errorf("Scheduled Banaifile %s: %s", e.File, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Handler the HTTP API of the agent:
+//  POST /jobs             queue a job. The body is a BuildRequest
+//  GET  /jobs             list all jobs
+//  GET  /jobs/{id}        state of a job
+//  GET  /jobs/{id}/log    the job log. Streams the log until the job ends
+//  POST /jobs/{id}/abort  abort a job
+//  GET  /jobs/{id}/stash/{name} a zip of a stash the job saved
+//  GET  /history          list past runs. Can be filtered by the status, target and limit query parameters
+//  GET  /history/{id}     a past run
+//  GET  /history/{id}/log the log of a past run
+//  POST /hooks/{name}     push webhook of a git server
+//All but the webhooks require the bearer token of the agent
+func (a *Agent) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/jobs", a.handleJobs)
+	api.HandleFunc("/jobs/", a.handleJob)
+	api.HandleFunc("/history", a.handleHistory)
+	api.HandleFunc("/history/", a.handleHistoryRun)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", a.authorize(api))
+	mux.HandleFunc("/hooks/", a.handleWebhook)
+	return mux
+}
+
+//pruneInterval how often ended jobs are checked for deletion, at most
+const pruneInterval = time.Minute
+
+//ListenAndServe run the jobs and serve the agent API on addr. The agent must have a token, see RequireToken
+func (a *Agent) ListenAndServe(addr string) error {
+	a.mutex.Lock()
+	token, retention := a.token, a.retention
+	a.mutex.Unlock()
+	if token == "" {
+		return fmt.Errorf("Agent has no API token")
+	}
+
+	var interval = pruneInterval
+	if retention > 0 && retention < interval {
+		interval = retention
+	}
+	go a.Run()
+	go a.pruneJobs(interval)
+	a.Logger.Info("Banai agent listening on ", addr)
+	return http.ListenAndServe(addr, a.Handler())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (a *Agent) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, a.Jobs())
+	case http.MethodPost:
+		var req BuildRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		job, err := a.Submit(req)
+		if err == ErrQueueFull {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, job)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Agent) handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	id := parts[0]
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		job, ok := a.Job(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case action == "log" && r.Method == http.MethodGet:
+		a.streamLog(w, r, id)
+	case action == "stash" && len(parts) == 3 && r.Method == http.MethodGet:
+		a.serveStash(w, r, id, parts[2])
+	case action == "abort" && r.Method == http.MethodPost:
+		if err := a.Abort(id); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *Agent) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := RunQuery{
+		Status: r.URL.Query().Get("status"),
+		Target: r.URL.Query().Get("target"),
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	runs, err := a.history.List(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (a *Agent) handleHistoryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/history/"), "/"), "/")
+	switch {
+	case len(parts) == 1:
+		run, err := a.history.Get(parts[0])
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	case len(parts) == 2 && parts[1] == "log":
+		log, err := a.history.Log(parts[0])
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(log)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *Agent) streamLog(w http.ResponseWriter, r *http.Request, id string) {
+	log, ok := a.log(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		data, complete := log.next(r.Context(), offset)
+		if complete {
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+		offset += len(data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
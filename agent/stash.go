@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sagiforbes/banai/infra"
+	"github.com/sagiforbes/banai/utils/fsutils"
+)
+
+//serveStash send a stash the job saved, as a zip, so a build on another machine can unstash it
+func (a *Agent) serveStash(w http.ResponseWriter, r *http.Request, id, name string) {
+	job, ok := a.Job(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if job.Status == JobQueued || job.Status == JobRunning {
+		writeError(w, http.StatusConflict, fmt.Errorf("Job %s is still %s", id, job.Status))
+		return
+	}
+	dir := infra.StashFolderOf(job.WorkDir, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Stash %s not found", name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	if err := fsutils.ZipFolderTo(w, dir); err != nil {
+		a.Logger.Error("Failed to send stash ", name, " of job ", id, " ", err)
+	}
+}
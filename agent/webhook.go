@@ -0,0 +1,356 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+//TriggerWebhook a job run by a push webhook
+const TriggerWebhook = "webhook"
+
+//Environment variables set for builds run by a push webhook
+const (
+	EnvTrigger        = "BANAI_TRIGGER"
+	EnvGitRef         = "BANAI_GIT_REF"
+	EnvGitBranch      = "BANAI_GIT_BRANCH"
+	EnvGitCommit      = "BANAI_GIT_COMMIT"
+	EnvGitAuthor      = "BANAI_GIT_AUTHOR"
+	EnvGitAuthorEmail = "BANAI_GIT_AUTHOR_EMAIL"
+	EnvGitRepository  = "BANAI_GIT_REPOSITORY"
+	EnvGitCloneURL    = "BANAI_GIT_CLONE_URL"
+)
+
+const maxWebhookPayload = 10 * 1024 * 1024
+
+//Webhook a Banaifile target to run when a git server posts a push event to /hooks/{name}
+type Webhook struct {
+	Name        string   `json:"name"`
+	File        string   `json:"file"`
+	Targets     []string `json:"targets,omitempty"`
+	SecretsFile string   `json:"secretsFile,omitempty"`
+	SecretID    string   `json:"secretId"`           //Id of a text secret, in SecretsFile, that signs the webhook payloads
+	Branches    []string `json:"branches,omitempty"` //Run only for pushes to these branches. Empty for all branches
+}
+
+//WebhookConfig content of a webhooks config file
+type WebhookConfig struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+//SecretFunc return the text of a text secret from a secrets file
+type SecretFunc func(secretsFile, secretID string) (string, error)
+
+//PushEvent what a push webhook tells about the push
+type PushEvent struct {
+	Ref         string
+	Branch      string
+	Commit      string
+	Author      string
+	AuthorEmail string
+	Repository  string
+	CloneURL    string
+}
+
+//Env the push event as environment variables of the build. Fields the payload did not have are left out
+func (p PushEvent) Env() map[string]string {
+	env := map[string]string{
+		EnvTrigger:        TriggerWebhook,
+		EnvGitRef:         p.Ref,
+		EnvGitBranch:      p.Branch,
+		EnvGitCommit:      p.Commit,
+		EnvGitAuthor:      p.Author,
+		EnvGitAuthorEmail: p.AuthorEmail,
+		EnvGitRepository:  p.Repository,
+		EnvGitCloneURL:    p.CloneURL,
+	}
+	for k, v := range env {
+		if v == "" {
+			delete(env, k)
+		}
+	}
+	return env
+}
+
+type commitInfo struct {
+	ID     string `json:"id"`
+	Author struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+}
+
+//pushPayload the fields banai uses from GitHub, Gitea and GitLab push payloads
+type pushPayload struct {
+	Ref         string       `json:"ref"`
+	After       string       `json:"after"`
+	CheckoutSHA string       `json:"checkout_sha"`
+	HeadCommit  *commitInfo  `json:"head_commit"`
+	Commits     []commitInfo `json:"commits"`
+	Pusher      struct {
+		Name  string `json:"name"`
+		Login string `json:"login"`
+		Email string `json:"email"`
+	} `json:"pusher"`
+	UserName   string `json:"user_name"`
+	UserEmail  string `json:"user_email"`
+	Repository struct {
+		FullName   string `json:"full_name"`
+		CloneURL   string `json:"clone_url"`
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"repository"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		GitHTTPURL        string `json:"git_http_url"`
+	} `json:"project"`
+}
+
+//LoadWebhookConfig read a webhooks config file. Relative file names in the config are relative to the config file folder
+func LoadWebhookConfig(fileName string) ([]Webhook, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var config WebhookConfig
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("Failed to parse webhooks config %s, %s", fileName, err)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(fileName))
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Webhooks {
+		h := &config.Webhooks[i]
+		if h.Name == "" || strings.Contains(h.Name, "/") {
+			return nil, fmt.Errorf("Webhook %d has an invalid name %q", i, h.Name)
+		}
+		if h.File == "" {
+			return nil, fmt.Errorf("Webhook %s has no file", h.Name)
+		}
+		if h.SecretID == "" || h.SecretsFile == "" {
+			return nil, fmt.Errorf("Webhook %s must have secretsFile and secretId", h.Name)
+		}
+		if !filepath.IsAbs(h.File) {
+			h.File = filepath.Join(dir, h.File)
+		}
+		if !filepath.IsAbs(h.SecretsFile) {
+			h.SecretsFile = filepath.Join(dir, h.SecretsFile)
+		}
+	}
+	return config.Webhooks, nil
+}
+
+//Webhooks serve the webhooks on /hooks/{name}. secret reads the secrets that sign the payloads
+func (a *Agent) Webhooks(hooks []Webhook, secret SecretFunc) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.webhooks = make(map[string]Webhook)
+	for _, h := range hooks {
+		if _, ok := a.webhooks[h.Name]; ok {
+			return fmt.Errorf("Webhook %s declared twice", h.Name)
+		}
+		text, err := secret(h.SecretsFile, h.SecretID)
+		if err != nil {
+			return fmt.Errorf("Webhook %s: %s", h.Name, err)
+		}
+		//An empty secret would accept unsigned GitLab requests, whose token is empty too
+		if text == "" {
+			return fmt.Errorf("Webhook %s: secret %s is empty", h.Name, h.SecretID)
+		}
+		a.webhooks[h.Name] = h
+	}
+	a.webhookSecret = secret
+	return nil
+}
+
+func hmacMatches(newHash func() hash.Hash, secret string, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+//verifyPush check the signature of a push webhook request. isPush is false for events other than push
+func verifyPush(r *http.Request, secret string, payload []byte) (isPush bool, err error) {
+	var event string
+	var signed bool
+
+	switch {
+	case r.Header.Get("X-Gitea-Event") != "":
+		event = r.Header.Get("X-Gitea-Event")
+		signed = hmacMatches(sha256.New, secret, payload, r.Header.Get("X-Gitea-Signature"))
+	case r.Header.Get("X-Gogs-Event") != "":
+		event = r.Header.Get("X-Gogs-Event")
+		signed = hmacMatches(sha256.New, secret, payload, r.Header.Get("X-Gogs-Signature"))
+	case r.Header.Get("X-GitHub-Event") != "":
+		event = r.Header.Get("X-GitHub-Event")
+		if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+			signed = hmacMatches(sha256.New, secret, payload, strings.TrimPrefix(sig, "sha256="))
+		} else {
+			signed = hmacMatches(sha1.New, secret, payload, strings.TrimPrefix(r.Header.Get("X-Hub-Signature"), "sha1="))
+		}
+	case r.Header.Get("X-Gitlab-Event") != "":
+		//GitLab sends the secret token as is instead of signing the payload
+		event = r.Header.Get("X-Gitlab-Event")
+		signed = subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) == 1
+		if event == "Push Hook" {
+			event = "push"
+		}
+	default:
+		return false, fmt.Errorf("Unknown webhook sender")
+	}
+
+	if !signed {
+		return false, fmt.Errorf("Invalid webhook signature")
+	}
+	return event == "push", nil
+}
+
+//isDeletedRef whether commit is the all zero SHA git servers send when a branch or tag is deleted
+func isDeletedRef(commit string) bool {
+	return commit != "" && strings.Trim(commit, "0") == ""
+}
+
+//parsePush read the push event from a GitHub, Gitea or GitLab push payload. It fails if it has no commit
+func parsePush(payload []byte) (PushEvent, error) {
+	var p pushPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return PushEvent{}, fmt.Errorf("Invalid push payload, %s", err)
+	}
+
+	event := PushEvent{
+		Ref:        p.Ref,
+		Commit:     p.After,
+		Repository: p.Repository.FullName,
+		CloneURL:   p.Repository.CloneURL,
+	}
+	if strings.HasPrefix(p.Ref, "refs/heads/") {
+		event.Branch = strings.TrimPrefix(p.Ref, "refs/heads/")
+	}
+	if p.CheckoutSHA != "" {
+		event.Commit = p.CheckoutSHA
+	}
+	if event.Commit == "" {
+		return PushEvent{}, fmt.Errorf("Invalid push payload, it has no commit")
+	}
+	if event.Repository == "" {
+		event.Repository = p.Project.PathWithNamespace
+	}
+	if event.CloneURL == "" {
+		event.CloneURL = p.Repository.GitHTTPURL
+	}
+	if event.CloneURL == "" {
+		event.CloneURL = p.Project.GitHTTPURL
+	}
+
+	var head *commitInfo
+	if p.HeadCommit != nil && p.HeadCommit.ID != "" {
+		head = p.HeadCommit
+	}
+	for i := range p.Commits {
+		if head == nil && p.Commits[i].ID == event.Commit {
+			head = &p.Commits[i]
+		}
+	}
+	switch {
+	case head != nil:
+		event.Author = head.Author.Name
+		event.AuthorEmail = head.Author.Email
+	case p.UserName != "":
+		event.Author = p.UserName
+		event.AuthorEmail = p.UserEmail
+	case p.Pusher.Name != "":
+		event.Author = p.Pusher.Name
+		event.AuthorEmail = p.Pusher.Email
+	default:
+		event.Author = p.Pusher.Login
+		event.AuthorEmail = p.Pusher.Email
+	}
+	return event, nil
+}
+
+func (a *Agent) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/hooks/"), "/")
+	a.mutex.Lock()
+	hook, ok := a.webhooks[name]
+	secretOf := a.webhookSecret
+	a.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	secret, err := secretOf(hook.SecretsFile, hook.SecretID)
+	if err == nil && secret == "" {
+		err = fmt.Errorf("Secret %s is empty", hook.SecretID)
+	}
+	if err != nil {
+		a.Logger.Error("Webhook ", name, " failed to read its secret ", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Failed to read webhook secret"))
+		return
+	}
+	isPush, err := verifyPush(r, secret, payload)
+	if err != nil {
+		a.Logger.Warn("Webhook ", name, " rejected: ", err)
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if !isPush {
+		writeJSON(w, http.StatusOK, map[string]string{"skipped": "Not a push event"})
+		return
+	}
+
+	push, err := parsePush(payload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if isDeletedRef(push.Commit) {
+		writeJSON(w, http.StatusOK, map[string]string{"skipped": "Ref was deleted"})
+		return
+	}
+	if len(hook.Branches) > 0 && !containsString(hook.Branches, push.Branch) {
+		writeJSON(w, http.StatusOK, map[string]string{"skipped": fmt.Sprintf("Branch %q is not built by this webhook", push.Branch)})
+		return
+	}
+
+	script, err := ioutil.ReadFile(hook.File)
+	if err != nil {
+		a.Logger.Error("Webhook ", name, " failed to read its Banaifile ", err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Failed to read Banaifile"))
+		return
+	}
+	job, err := a.submit(BuildRequest{
+		Script:      string(script),
+		Targets:     hook.Targets,
+		SecretsFile: hook.SecretsFile,
+		Env:         push.Env(),
+	}, TriggerWebhook)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
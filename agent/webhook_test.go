@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(newHash func() hash.Hash, secret string, payload []byte) string {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyPush(t *testing.T) {
+	const secret = "hook-secret"
+	var payload = []byte(`{"ref":"refs/heads/main","after":"abc"}`)
+	var tests = []struct {
+		name    string
+		headers map[string]string
+		isPush  bool
+		wantErr bool
+	}{
+		{
+			name:    "github sha256",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, payload)},
+			isPush:  true,
+		},
+		{
+			name:    "github sha1",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha1=" + sign(sha1.New, secret, payload)},
+			isPush:  true,
+		},
+		{
+			name:    "github other event",
+			headers: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, payload)},
+			isPush:  false,
+		},
+		{
+			name:    "github wrong secret",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, "other", payload)},
+			wantErr: true,
+		},
+		{
+			name:    "github sha1 signature in the sha256 header",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(sha1.New, secret, payload)},
+			wantErr: true,
+		},
+		{
+			name:    "github unsigned",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			wantErr: true,
+		},
+		{
+			name:    "github signature not hex",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=zz"},
+			wantErr: true,
+		},
+		{
+			name:    "gitea",
+			headers: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(sha256.New, secret, payload)},
+			isPush:  true,
+		},
+		{
+			name:    "gitea wrong secret",
+			headers: map[string]string{"X-Gitea-Event": "push", "X-Gitea-Signature": sign(sha256.New, "other", payload)},
+			wantErr: true,
+		},
+		{
+			name:    "gogs",
+			headers: map[string]string{"X-Gogs-Event": "push", "X-Gogs-Signature": sign(sha256.New, secret, payload)},
+			isPush:  true,
+		},
+		{
+			name:    "gitlab",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": secret},
+			isPush:  true,
+		},
+		{
+			name:    "gitlab tag push",
+			headers: map[string]string{"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Token": secret},
+			isPush:  false,
+		},
+		{
+			name:    "gitlab wrong token",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "other"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown sender",
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign(sha256.New, secret, payload)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/hooks/app", strings.NewReader(string(payload)))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			isPush, err := verifyPush(r, secret, payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("verifyPush accepted the request")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyPush failed: %s", err)
+			}
+			if isPush != tt.isPush {
+				t.Errorf("isPush = %v, want %v", isPush, tt.isPush)
+			}
+		})
+	}
+}
+
+func TestVerifyPushTamperedPayload(t *testing.T) {
+	const secret = "hook-secret"
+	var payload = []byte(`{"ref":"refs/heads/main"}`)
+	r := httptest.NewRequest(http.MethodPost, "/hooks/app", nil)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, secret, payload))
+	if _, err := verifyPush(r, secret, []byte(`{"ref":"refs/heads/prod"}`)); err == nil {
+		t.Errorf("verifyPush accepted a payload that does not match its signature")
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	var tests = []struct {
+		name    string
+		payload string
+		want    PushEvent
+		wantErr bool
+	}{
+		{
+			name: "github",
+			payload: `{"ref":"refs/heads/main","after":"abc123",
+				"head_commit":{"id":"abc123","author":{"name":"Dana","email":"dana@example.com"}},
+				"pusher":{"name":"pusher"},
+				"repository":{"full_name":"org/app","clone_url":"https://example.com/org/app.git"}}`,
+			want: PushEvent{Ref: "refs/heads/main", Branch: "main", Commit: "abc123", Author: "Dana",
+				AuthorEmail: "dana@example.com", Repository: "org/app", CloneURL: "https://example.com/org/app.git"},
+		},
+		{
+			name: "gitlab",
+			payload: `{"ref":"refs/heads/dev","before":"111","after":"222","checkout_sha":"222",
+				"user_name":"Lee","user_email":"lee@example.com",
+				"commits":[{"id":"111","author":{"name":"Old"}},{"id":"222","author":{"name":"Kim","email":"kim@example.com"}}],
+				"project":{"path_with_namespace":"group/app","git_http_url":"https://example.com/group/app.git"}}`,
+			want: PushEvent{Ref: "refs/heads/dev", Branch: "dev", Commit: "222", Author: "Kim",
+				AuthorEmail: "kim@example.com", Repository: "group/app", CloneURL: "https://example.com/group/app.git"},
+		},
+		{
+			name:    "gitea without commits",
+			payload: `{"ref":"refs/heads/main","after":"abc","pusher":{"login":"robin","email":"robin@example.com"}}`,
+			want:    PushEvent{Ref: "refs/heads/main", Branch: "main", Commit: "abc", Author: "robin", AuthorEmail: "robin@example.com"},
+		},
+		{
+			name:    "tag",
+			payload: `{"ref":"refs/tags/v1.0","after":"abc"}`,
+			want:    PushEvent{Ref: "refs/tags/v1.0", Commit: "abc"},
+		},
+		{
+			name:    "deleted branch",
+			payload: `{"ref":"refs/heads/old","after":"0000000000000000000000000000000000000000"}`,
+			want:    PushEvent{Ref: "refs/heads/old", Branch: "old", Commit: "0000000000000000000000000000000000000000"},
+		},
+		{name: "no commit", payload: `{"ref":"refs/heads/main"}`, wantErr: true},
+		{name: "empty commit", payload: `{"ref":"refs/heads/main","after":""}`, wantErr: true},
+		{name: "not json", payload: `ref=main`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePush([]byte(tt.payload))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePush = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePush failed: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("parsePush = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDeletedRef(t *testing.T) {
+	var tests = []struct {
+		commit string
+		want   bool
+	}{
+		{commit: "0000000000000000000000000000000000000000", want: true},
+		{commit: "0", want: true},
+		{commit: "", want: false},
+		{commit: "a000000000000000000000000000000000000000", want: false},
+		{commit: "abc123", want: false},
+	}
+	for _, tt := range tests {
+		if got := isDeletedRef(tt.commit); got != tt.want {
+			t.Errorf("isDeletedRef(%q) = %v, want %v", tt.commit, got, tt.want)
+		}
+	}
+}
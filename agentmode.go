@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/agent"
+)
+
+const (
+	defaultAgentAddr      = "127.0.0.1:8060"
+	defaultAgentDir       = "banai-agent"
+	defaultAgentRetention = 7 * 24 * time.Hour
+)
+
+//agentOptions the command line options of the agent
+type agentOptions struct {
+	Addr          string
+	Dir           string
+	ScheduleFile  string
+	WebhooksFile  string
+	TokenSecretID string        //Id of the text secret, in the secrets file of the agent, that is the API token
+	SecretsDir    string        //Folder of the secrets files jobs can name
+	Retention     time.Duration //How long ended jobs, and their folders, are kept
+}
+
+//agentBuild runs a job of the agent through runBuild. The Banaifile of the job is saved in workDir and
+//the build runs with workDir as its working directory. defaults holds the options of the agent command line
+func agentBuild(req agent.BuildRequest, defaults buildOptions, workDir string, out io.Writer, abort <-chan struct{}) (string, error) {
+	scriptFileName := filepath.Join(workDir, defaultScriptFileName+".js")
+	if err := ioutil.WriteFile(scriptFileName, []byte(req.Script), 0644); err != nil {
+		return "", err
+	}
+
+	//The agent resolved the secrets file of a request to an absolute path in its secrets folder
+	secretsFile := req.SecretsFile
+
+	agentDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if err = os.Chdir(workDir); err != nil {
+		return "", err
+	}
+	defer os.Chdir(agentDir)
+
+	var env = make([]string, 0, len(req.Env))
+	for k, v := range req.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+
+	doneCH, abortCH, err := runBuild(buildOptions{
+		ScriptFileName: scriptFileName,
+		Targets:        req.Targets,
+		SecretsFile:    secretsFile,
+		Out:            out,
+		Env:            env,
+		Params:         req.Params,
+		DryRun:         req.DryRun,
+		CacheDir:       defaults.CacheDir,
+		CacheSizeMB:    defaults.CacheSizeMB,
+		KeepStash:      true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result buildResult
+	select {
+	case result = <-doneCH:
+	case <-abort:
+		abortCH <- true
+		result = <-doneCH
+	}
+
+	if result.Err != nil {
+		return "", result.Err
+	}
+	if result.Value == nil || goja.IsUndefined(result.Value) {
+		return "", nil
+	}
+	return fmt.Sprint(result.Value), nil
+}
+
+//scheduleEntries read a schedule config file. Entries without a cron expression are replaced by the
+//scheduled runs declared in their Banaifile
+func scheduleEntries(configFile string) ([]agent.ScheduleEntry, error) {
+	entries, err := agent.LoadScheduleConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret = make([]agent.ScheduleEntry, 0)
+	for _, e := range entries {
+		if e.Cron != "" {
+			ret = append(ret, e)
+			continue
+		}
+		declared, err := declaredSchedules(e.File)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read schedules of %s, %s", e.File, err)
+		}
+		for _, d := range declared {
+			entry := e
+			entry.Cron = d.Cron
+			entry.Targets = []string{d.Target}
+			if d.Overlap != "" {
+				entry.Overlap = d.Overlap
+			}
+			if d.Missed != "" {
+				entry.Missed = d.Missed
+			}
+			ret = append(ret, entry)
+		}
+	}
+	return ret, nil
+}
+
+func runAgent(opt agentOptions, defaults buildOptions) error {
+	a, err := agent.New(opt.Dir, func(req agent.BuildRequest, workDir string, out io.Writer, abort <-chan struct{}) (string, error) {
+		return agentBuild(req, defaults, workDir, out, abort)
+	})
+	if err != nil {
+		return err
+	}
+
+	if opt.TokenSecretID == "" || defaults.SecretsFile == "" {
+		return fmt.Errorf("The agent API requires a token. Set -agent-token to the id of a text secret in the -s secrets file")
+	}
+	token, err := textSecretFromFile(defaults.SecretsFile, opt.TokenSecretID)
+	if err != nil {
+		return fmt.Errorf("Failed to read agent token %s, %s", opt.TokenSecretID, err)
+	}
+	if err = a.RequireToken(token); err != nil {
+		return err
+	}
+	if opt.SecretsDir != "" {
+		if err = a.SecretsFolder(opt.SecretsDir); err != nil {
+			return err
+		}
+	}
+	a.KeepJobs(opt.Retention)
+
+	if opt.WebhooksFile != "" {
+		hooks, err := agent.LoadWebhookConfig(opt.WebhooksFile)
+		if err != nil {
+			return err
+		}
+		if err = a.Webhooks(hooks, textSecretFromFile); err != nil {
+			return err
+		}
+	}
+	if opt.ScheduleFile != "" {
+		entries, err := scheduleEntries(opt.ScheduleFile)
+		if err != nil {
+			return err
+		}
+		if err = a.Schedule(entries); err != nil {
+			return err
+		}
+	}
+	return a.ListenAndServe(opt.Addr)
+}
@@ -28,6 +28,9 @@ func discoverFilesInFolder(folderPath string) []string {
 }
 
 func archiveToZip(zipFileName string, sourcePath string) []string {
+	if banai.SkipOnDryRun("Zip %s into %s", sourcePath, zipFileName) {
+		return discoverFilesInFolder(sourcePath)
+	}
 
 	zippedFiles, err := fsutils.ZipFolder(zipFileName, sourcePath)
 	banai.PanicOnError(err)
@@ -37,6 +40,9 @@ func archiveToZip(zipFileName string, sourcePath string) []string {
 }
 
 func unarchiveFromZip(zipFileName, targetPath string) []string {
+	if banai.SkipOnDryRun("Unzip %s into %s", zipFileName, targetPath) {
+		return []string{}
+	}
 
 	fileList, err := fsutils.Unzip(zipFileName, targetPath)
 	banai.PanicOnError(err)
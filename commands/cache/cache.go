@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/infra"
+)
+
+var banai *infra.Banai
+
+func exportPaths(v goja.Value) []string {
+	var paths = make([]string, 0)
+	if s, ok := v.Export().(string); ok {
+		paths = append(paths, s)
+	} else if err := banai.Jse.ExportTo(v, &paths); err != nil {
+		banai.PanicOnError(fmt.Errorf("Cache paths must be a path or an array of paths"))
+	}
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			banai.PanicOnError(fmt.Errorf("Cache path is empty"))
+		}
+	}
+	if len(paths) == 0 {
+		banai.PanicOnError(fmt.Errorf("No paths to cache"))
+	}
+	return paths
+}
+
+//cache restore paths from the cache if key is in it. Otherwise run fn and save paths in the cache once it
+//succeeds: cache(key, paths, fn). Returns true if the paths were restored from the cache
+func cache(call goja.FunctionCall) goja.Value {
+	key := call.Argument(0).String()
+	if key == "" || goja.IsUndefined(call.Argument(0)) {
+		banai.PanicOnError(fmt.Errorf("Cache key is empty"))
+	}
+	paths := exportPaths(call.Argument(1))
+	fn, ok := goja.AssertFunction(call.Argument(2))
+	if !ok {
+		banai.PanicOnError(fmt.Errorf("Cache of %s must have a function that creates the cached paths", key))
+	}
+
+	s := &store{dir: banai.CacheDir, sizeLimit: banai.CacheSizeLimit}
+	if !banai.SkipOnDryRun("Restore %s from cache %s", strings.Join(paths, ", "), key) {
+		restored, err := s.restore(key, paths)
+		if err != nil {
+			banai.Logger.Warn("Failed to restore cache ", key, ", running without it. ", err)
+		}
+		if restored {
+			banai.Logger.Info("Restored ", strings.Join(paths, ", "), " from cache ", key)
+			return banai.Jse.ToValue(true)
+		}
+		banai.Logger.Info("Cache ", key, " not found")
+	}
+
+	if _, err := fn(goja.Undefined()); err != nil {
+		if ex, ok := err.(*goja.Exception); ok {
+			panic(ex.Value())
+		}
+		banai.PanicOnError(err)
+	}
+
+	if !banai.SkipOnDryRun("Save %s to cache %s", strings.Join(paths, ", "), key) {
+		//A cache that cannot be saved only makes the next run slower
+		if err := s.save(key, paths); err != nil {
+			banai.Logger.Warn("Failed to save cache ", key, " ", err)
+		}
+	}
+	return banai.Jse.ToValue(false)
+}
+
+//RegisterJSObjects registers the cache function
+func RegisterJSObjects(b *infra.Banai) {
+	banai = b
+
+	banai.Jse.GlobalObject().Set("cache", cache)
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sagiforbes/banai/utils/fsutils"
+)
+
+const (
+	entryFileName    = "entry.json"
+	entryDataName    = "data"
+	tmpEntryPrefix   = "tmp-"
+	tmpRestorePrefix = ".banai-restore-"
+)
+
+//entry what is kept about a cache entry. The saved paths are in the data folder of the entry, by their index in Paths
+type entry struct {
+	Key      string    `json:"key"`
+	Paths    []string  `json:"paths"`
+	Saved    []bool    `json:"saved"` //false for paths that did not exist when the entry was saved
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+//store a folder of cache entries, each in a folder named by the hash of its key
+type store struct {
+	dir       string
+	sizeLimit int64
+}
+
+func (s *store) entryDir(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func readEntry(entryDir string) (entry, error) {
+	var e entry
+	b, err := ioutil.ReadFile(filepath.Join(entryDir, entryFileName))
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(b, &e)
+	return e, err
+}
+
+func writeEntry(entryDir string, e entry) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := filepath.Join(entryDir, entryFileName+".tmp")
+	if err = ioutil.WriteFile(tmpFile, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(entryDir, entryFileName))
+}
+
+//samePaths whether the paths of a call are the paths an entry was saved with
+func samePaths(paths, saved []string) bool {
+	if len(paths) != len(saved) {
+		return false
+	}
+	for i := range paths {
+		if filepath.Clean(paths[i]) != filepath.Clean(saved[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//restore copy paths back from the entry of key. ok is false if key is not in the cache, or was saved with other
+//paths. The saved paths are copied next to where they go first, so a failed restore leaves the paths unchanged
+func (s *store) restore(key string, paths []string) (ok bool, err error) {
+	dir := s.entryDir(key)
+	e, err := readEntry(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if e.Key != key || !samePaths(paths, e.Paths) {
+		return false, nil
+	}
+
+	var staged = make([]string, len(paths))
+	defer func() {
+		for _, tmp := range staged {
+			if tmp != "" {
+				os.RemoveAll(tmp)
+			}
+		}
+	}()
+	for i, path := range paths {
+		if !e.Saved[i] {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return false, err
+		}
+		staged[i] = filepath.Join(filepath.Dir(path), tmpRestorePrefix+uuid.NewString())
+		if _, err = fsutils.CopyTree(filepath.Join(dir, entryDataName, strconv.Itoa(i)), staged[i]); err != nil {
+			return false, err
+		}
+	}
+
+	for i, path := range paths {
+		if err = os.RemoveAll(path); err != nil {
+			return false, err
+		}
+		if staged[i] == "" {
+			continue
+		}
+		if err = os.Rename(staged[i], path); err != nil {
+			return false, err
+		}
+		staged[i] = ""
+	}
+
+	e.LastUsed = time.Now()
+	return true, writeEntry(dir, e)
+}
+
+//save copy paths into the cache under key, then evict the least recently used entries above the size limit
+func (s *store) save(key string, paths []string) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	//Copy to a temporary folder first, so other banai processes never see a partly saved entry
+	tmpDir := filepath.Join(s.dir, tmpEntryPrefix+uuid.NewString())
+	defer os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, entryDataName), 0755); err != nil {
+		return err
+	}
+
+	e := entry{
+		Key:      key,
+		Paths:    paths,
+		Saved:    make([]bool, len(paths)),
+		Created:  time.Now(),
+		LastUsed: time.Now(),
+	}
+	for i, path := range paths {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		n, err := fsutils.CopyTree(path, filepath.Join(tmpDir, entryDataName, strconv.Itoa(i)))
+		if err != nil {
+			return fmt.Errorf("Failed to save %s to cache, %s", path, err)
+		}
+		e.Size += n
+		e.Saved[i] = true
+	}
+	if err := writeEntry(tmpDir, e); err != nil {
+		return err
+	}
+
+	dir := s.entryDir(key)
+	os.RemoveAll(dir)
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return err
+	}
+	return s.evict(dir)
+}
+
+//evict remove the least recently used entries until the cache fits its size limit. keep is never removed
+func (s *store) evict(keep string) error {
+	if s.sizeLimit <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		dir string
+		entry
+	}
+	var entries = make([]cached, 0)
+	var total int64
+	for _, f := range files {
+		dir := filepath.Join(s.dir, f.Name())
+		if !f.IsDir() || dir == keep {
+			continue
+		}
+		e, err := readEntry(dir)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cached{dir: dir, entry: e})
+		total += e.Size
+	}
+	if e, err := readEntry(keep); err == nil {
+		total += e.Size
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.Before(entries[j].LastUsed) })
+	for _, e := range entries {
+		if total <= s.sizeLimit {
+			break
+		}
+		if err = os.RemoveAll(e.dir); err != nil {
+			return err
+		}
+		total -= e.Size
+	}
+	return nil
+}
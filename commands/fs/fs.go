@@ -68,6 +68,9 @@ func writeFile(fileName string, v goja.Value) {
 			banai.PanicOnError(errors.New("Cannot save this type of data. Can be string or ByteArray"))
 		}
 	}
+	if banai.SkipOnDryRun("Write %d bytes to %s", len(asByteArray), fileName) {
+		return
+	}
 
 	err := ioutil.WriteFile(fileName, asByteArray, 0644)
 	if err != nil {
@@ -78,6 +81,9 @@ func writeFile(fileName string, v goja.Value) {
 func createDir(dirName string) {
 	s, err := os.Stat(dirName)
 	if os.IsNotExist(err) {
+		if banai.SkipOnDryRun("Create dir %s", dirName) {
+			return
+		}
 		if err := os.MkdirAll(dirName, 0755); err != nil {
 			banai.PanicOnError(fmt.Errorf("Failed to create dir %s", err))
 		}
@@ -89,6 +95,9 @@ func createDir(dirName string) {
 }
 
 func fsRemoveDir(itemName string) {
+	if banai.SkipOnDryRun("Delete all under %s", itemName) {
+		return
+	}
 	banai.Logger.Info("Deleting all under ", itemName)
 	err := os.RemoveAll(itemName)
 	if err != nil {
@@ -100,6 +109,9 @@ func fsRemoveDir(itemName string) {
 }
 
 func fsRemove(itemName string) {
+	if banai.SkipOnDryRun("Delete %s", itemName) {
+		return
+	}
 
 	err := os.Remove(itemName)
 	if err != nil {
@@ -144,21 +156,27 @@ func copyFiles(sourceFileName, destinationFileName string) error {
 }
 
 func fsCopy(sourceFileName, destinationFileName string) {
+	if banai.SkipOnDryRun("Copy %s -> %s", sourceFileName, destinationFileName) {
+		return
+	}
 	err := fsutils.CopyfsItem(sourceFileName, destinationFileName)
 	if err != nil {
-		banai.PanicOnError(fmt.Errorf("Failed to copy files ", err))
+		banai.PanicOnError(fmt.Errorf("Failed to copy files %s", err))
 	}
 
 }
 
 func fsMove(sourceFileName, destinationFileName string) {
+	if banai.SkipOnDryRun("Move %s -> %s", sourceFileName, destinationFileName) {
+		return
+	}
 
-	result, err := shellutils.RunShellCommand(fmt.Sprintf("mv %s %s", sourceFileName, destinationFileName))
+	result, err := shellutils.RunCommand("mv", []string{"--", sourceFileName, destinationFileName})
 	if err != nil {
-		banai.PanicOnError(fmt.Errorf("Failed to move ", err))
+		banai.PanicOnError(fmt.Errorf("Failed to move %s", err))
 	}
 	if result.Code != 0 {
-		banai.PanicOnError(fmt.Errorf("Move exit code ", result.Code))
+		banai.PanicOnError(fmt.Errorf("Move exit code %d", result.Code))
 	}
 
 }
@@ -98,6 +98,17 @@ func sha256File(fileName string) string {
 	return genericHashCalculator(sha256.New(), f)
 }
 
+//FileSha256 the sha256 of a file content, for banai packages that hash files without raising a javascript exception
+func FileSha256(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return genericHashCalculator(sha256.New(), f), nil
+}
+
 //RegisterJSObjects registers Shell objects and functions
 func RegisterJSObjects(b *infra.Banai) {
 	banai = b
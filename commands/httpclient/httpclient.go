@@ -234,6 +234,16 @@ func responseInfoFromHTTPresponse(httpRes *http.Response) (res *responseInfo) {
 	return
 }
 
+//dryRunResponse the response of a request skipped by a dry run
+func dryRunResponse() *responseInfo {
+	return &responseInfo{
+		Status:  http.StatusOK,
+		Body:    banai.Jse.ToValue(""),
+		Header:  make(map[string]string),
+		Cookies: make([]*http.Cookie, 0),
+	}
+}
+
 //******************** REST REQUESTS
 func getRequest(urlPath string, reqOpt ...RequestOpt) *responseInfo {
 	var req *http.Request
@@ -265,6 +275,10 @@ func postRequest(urlPath string, body []byte, reqOpt ...RequestOpt) *responseInf
 		opt = reqOpt[0]
 	}
 
+	if banai.SkipOnDryRun("HTTP POST %s with %d bytes body", urlPath, len(body)) {
+		return dryRunResponse()
+	}
+
 	bodyReader := bytes.NewBuffer(body)
 
 	req, err = createRequestByOpt(opt, urlPath, http.MethodPost, bodyReader)
@@ -286,6 +300,10 @@ func putRequest(urlPath string, body []byte, reqOpt ...RequestOpt) *responseInfo
 		opt = reqOpt[0]
 	}
 
+	if banai.SkipOnDryRun("HTTP PUT %s with %d bytes body", urlPath, len(body)) {
+		return dryRunResponse()
+	}
+
 	bodyReader := bytes.NewBuffer(body)
 
 	req, err = createRequestByOpt(opt, urlPath, http.MethodPut, bodyReader)
@@ -308,6 +326,10 @@ func patchRequest(urlPath string, body []byte, reqOpt ...RequestOpt) *responseIn
 		opt = reqOpt[0]
 	}
 
+	if banai.SkipOnDryRun("HTTP PATCH %s with %d bytes body", urlPath, len(body)) {
+		return dryRunResponse()
+	}
+
 	bodyReader := bytes.NewBuffer(body)
 
 	req, err = createRequestByOpt(opt, urlPath, http.MethodPatch, bodyReader)
@@ -330,6 +352,10 @@ func deleteRequest(urlPath string, body []byte, reqOpt ...RequestOpt) *responseI
 		opt = reqOpt[0]
 	}
 
+	if banai.SkipOnDryRun("HTTP DELETE %s with %d bytes body", urlPath, len(body)) {
+		return dryRunResponse()
+	}
+
 	bodyReader := bytes.NewBuffer(body)
 
 	req, err = createRequestByOpt(opt, urlPath, http.MethodDelete, bodyReader)
@@ -389,6 +415,10 @@ func httpPostForm(urlPath string, fields map[string]string, files map[string]str
 		opt = reqOpt[0]
 	}
 
+	if banai.SkipOnDryRun("HTTP POST form %s", urlPath) {
+		return dryRunResponse()
+	}
+
 	req, err = createRequestByForm(opt, urlPath, fields, files)
 	banai.PanicOnError(err)
 	client = createHTTPClientFromOpt(opt)
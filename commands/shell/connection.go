@@ -0,0 +1,149 @@
+package shell
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/dop251/goja"
+
+	"github.com/sagiforbes/banai/utils/shellutils"
+	"github.com/sagiforbes/banai/utils/sshutils"
+)
+
+//sshConnection the object sshConnect returns to the script. Its commands and transfers share one connection.
+//It has no client in a dry run
+type sshConnection struct {
+	Address string `json:"address"`
+	client  *sshutils.Client
+	mutex   sync.Mutex //Guards closed. The cleanup of an aborted build closes the connection from another goroutine
+	closed  bool
+}
+
+//open the client of the connection, or fail if the connection was closed
+func (c *sshConnection) open() *sshutils.Client {
+	c.mutex.Lock()
+	closed := c.closed
+	c.mutex.Unlock()
+	if closed {
+		banai.PanicOnError(fmt.Errorf("Connection to %s is closed", c.Address))
+	}
+	return c.client
+}
+
+//Run execute a command on the remote host, like rsh: run(cmd, [opt])
+func (c *sshConnection) Run(cmd string, cmdOpt ...scriptOptions) *shellutils.ShellResult {
+	client := c.open()
+	if banai.SkipOnDryRun("Run remote command on %s: %s", c.Address, cmd) {
+		return &shellutils.ShellResult{}
+	}
+
+	opt := remoteOptions(cmdOpt...)
+	ret, e := shellutils.RunRemoteCommand(client, cmd, opt)
+	panicOnRunError(e)
+	checkResult(cmd, opt, ret)
+	return ret
+}
+
+//Upload copy a local file, or a folder with all its content, to the remote host: upload(localFile, remoteFile)
+func (c *sshConnection) Upload(localFile, remoteFile string) {
+	client := c.open()
+	if banai.SkipOnDryRun("Upload %s to %s:%s", localFile, c.Address, remoteFile) {
+		return
+	}
+	upload(client, localFile, remoteFile)
+}
+
+//Download copy a file, or a folder with all its content, of the remote host to the local host:
+//download(remoteFile, localFile)
+func (c *sshConnection) Download(remoteFile, localFile string) {
+	client := c.open()
+	if banai.SkipOnDryRun("Download %s:%s to %s", c.Address, remoteFile, localFile) {
+		return
+	}
+	download(client, remoteFile, localFile)
+}
+
+//List the items of a remote folder, like sftpList: list(remoteDir). Empty in a dry run
+func (c *sshConnection) List(remoteDir string) []remoteFileInfo {
+	client := c.open()
+	if client == nil {
+		return make([]remoteFileInfo, 0)
+	}
+	return listRemote(client, remoteDir)
+}
+
+//Stat information about a remote file or folder, like sftpStat: stat(remotePath). Only the name is set in a dry run
+func (c *sshConnection) Stat(remotePath string) remoteFileInfo {
+	client := c.open()
+	if client == nil {
+		return remoteFileInfo{Name: path.Base(remotePath)}
+	}
+	return statRemote(client, remotePath)
+}
+
+//Mkdir create a remote folder and the folders above it that are missing: mkdir(remoteDir)
+func (c *sshConnection) Mkdir(remoteDir string) {
+	client := c.open()
+	if banai.SkipOnDryRun("Create folder %s:%s", c.Address, remoteDir) {
+		return
+	}
+	banai.PanicOnError(client.Mkdir(remoteDir), "Remote", remoteDir)
+}
+
+//Remove a remote file, or a folder with all its content: remove(remotePath)
+func (c *sshConnection) Remove(remotePath string) {
+	client := c.open()
+	if banai.SkipOnDryRun("Remove %s:%s", c.Address, remotePath) {
+		return
+	}
+	banai.PanicOnError(client.Remove(remotePath), "Remote", remotePath)
+}
+
+//Chmod change the mode of a remote file or folder: chmod(remotePath, mode)
+func (c *sshConnection) Chmod(remotePath string, mode goja.Value) {
+	client := c.open()
+	var m = fileMode(mode)
+	if banai.SkipOnDryRun("Change mode of %s:%s to %o", c.Address, remotePath, m) {
+		return
+	}
+	banai.PanicOnError(client.Chmod(remotePath, m), "Remote", remotePath)
+}
+
+//Rename a remote file or folder: rename(oldPath, newPath)
+func (c *sshConnection) Rename(oldPath, newPath string) {
+	client := c.open()
+	if banai.SkipOnDryRun("Rename %s:%s to %s", c.Address, oldPath, newPath) {
+		return
+	}
+	banai.PanicOnError(client.Rename(oldPath, newPath), "Remote", oldPath)
+}
+
+//Close close the connection. Closing it again does nothing
+func (c *sshConnection) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if c.client != nil {
+		c.client.Close()
+	}
+}
+
+//sshConnect connect to a remote host and return a connection to run commands and transfer files on:
+//sshConnect(sshConf). The connection is closed when the script ends, if it was not closed before
+func sshConnect(sshConf shellutils.ShellSSHConfig) *sshConnection {
+	sshConf = resolveSSHConfig(sshConf)
+	var conn = &sshConnection{Address: sshConf.Address}
+	if banai.SkipOnDryRun("Connect to %s", sshConf.Address) {
+		return conn
+	}
+
+	client, e := shellutils.DialSSH(sshConf)
+	banai.PanicOnError(e)
+	conn.client = client
+	banai.OnClose(conn.Close)
+	return conn
+}
@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/sagiforbes/banai/utils/shellutils"
+)
+
+//processHandle the object shStart returns to the script. It has no process in a dry run
+type processHandle struct {
+	Pid     int `json:"pid"`
+	process *shellutils.Process
+	command string
+	check   bool //Set by the check option. setShellCheck does not apply, since started processes are often killed
+}
+
+//Wait wait for the process to end and return its result
+func (h *processHandle) Wait() *shellutils.ShellResult {
+	if h.process == nil {
+		return &shellutils.ShellResult{}
+	}
+	ret := h.process.Wait()
+	if h.check {
+		banai.PanicOnError(shellutils.CheckResult(h.command, ret))
+	}
+	return ret
+}
+
+//Kill send a signal, SIGTERM by default, to the process and all the processes it started: kill([signal])
+func (h *processHandle) Kill(signal ...interface{}) {
+	if h.process == nil {
+		return
+	}
+	var name = "SIGTERM"
+	if len(signal) > 0 && signal[0] != nil {
+		name = fmt.Sprint(signal[0])
+	}
+	sig, err := shellutils.ParseSignal(name)
+	banai.PanicOnError(err)
+	banai.PanicOnError(h.process.Signal(sig))
+}
+
+//IsRunning true until the process ends
+func (h *processHandle) IsRunning() bool {
+	return h.process != nil && h.process.IsRunning()
+}
+
+//ReadOut the standard output of the process since the last call to readOut
+func (h *processHandle) ReadOut() string {
+	if h.process == nil {
+		return ""
+	}
+	return h.process.ReadOut()
+}
+
+//ReadErr the standard error of the process since the last call to readErr
+func (h *processHandle) ReadErr() string {
+	if h.process == nil {
+		return ""
+	}
+	return h.process.ReadErr()
+}
+
+//defaultExpectTimeout how long expect waits, in seconds, when no timeout is given
+const defaultExpectTimeout = 30
+
+//toRegexp the regular expression of a JS RegExp object or of a pattern string
+func toRegexp(pattern goja.Value) (*regexp.Regexp, error) {
+	if obj, ok := pattern.(*goja.Object); ok && obj.ClassName() == "RegExp" {
+		var flags string
+		if obj.Get("ignoreCase").ToBoolean() {
+			flags += "i"
+		}
+		if obj.Get("multiline").ToBoolean() {
+			flags += "m"
+		}
+		source := obj.Get("source").String()
+		if flags != "" {
+			source = "(?" + flags + ")" + source
+		}
+		return regexp.Compile(source)
+	}
+	return regexp.Compile(pattern.String())
+}
+
+//Expect wait until the output matches pattern, a RegExp or a string, and return the match and its groups:
+//expect(pattern, [timeout]). timeout is in seconds. Each call continues after what the previous one matched
+func (h *processHandle) Expect(pattern goja.Value, timeout ...float64) []string {
+	if h.process == nil {
+		return []string{}
+	}
+	re, err := toRegexp(pattern)
+	banai.PanicOnError(err)
+	var seconds float64 = defaultExpectTimeout
+	if len(timeout) > 0 && timeout[0] > 0 {
+		seconds = timeout[0]
+	}
+	match, err := h.process.Expect(re, time.Duration(seconds*float64(time.Second)))
+	banai.PanicOnError(err)
+	return match
+}
+
+//Send write text to the terminal of a process started with pty: send(text). A line end is not added
+func (h *processHandle) Send(text string) {
+	if h.process == nil {
+		return
+	}
+	banai.PanicOnError(h.process.Send(text))
+}
+
+//shellStart start a shell command in the background and return a handle to it: shStart(cmd, [options]).
+//The command, and every process it started, is stopped when the script ends if it is still running
+func shellStart(cmd string, cmdOpt ...shellutils.CommandOptions) *processHandle {
+	opt := commandOptions(cmdOpt...)
+	if banai.SkipOnDryRun("Start shell command: %s", cmd) {
+		return &processHandle{}
+	}
+	p, err := shellutils.StartShellCommand(cmd, opt)
+	banai.PanicOnError(err)
+	remove := banai.OnClose(func() {
+		if p.IsRunning() {
+			banai.Logger.Info("Stopping process ", p.Pid(), " started by: ", cmd)
+			p.Stop(shellutils.DefaultStopGrace)
+		}
+	})
+	go func() {
+		p.Wait()
+		remove()
+	}()
+	return &processHandle{Pid: p.Pid(), process: p, command: cmd, check: opt.Check != nil && *opt.Check}
+}
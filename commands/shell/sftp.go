@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/utils/shellutils"
+	"github.com/sagiforbes/banai/utils/sshutils"
+)
+
+//remoteFileInfo information about a file or folder of a remote host, like fsItemInfo
+type remoteFileInfo struct {
+	Name         string    `json:"name"`
+	IsDir        bool      `json:"isDir,omitempty"`
+	IsFile       bool      `json:"isFile,omitempty"`
+	IsLink       bool      `json:"isLink,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	Mode         uint32    `json:"mode"`
+	LastModified time.Time `json:"lastModified,omitempty"`
+}
+
+func newRemoteFileInfo(info os.FileInfo) remoteFileInfo {
+	return remoteFileInfo{
+		Name:         info.Name(),
+		IsDir:        info.IsDir(),
+		IsFile:       info.Mode().IsRegular(),
+		IsLink:       info.Mode()&os.ModeSymlink != 0,
+		Size:         info.Size(),
+		Mode:         uint32(info.Mode().Perm()),
+		LastModified: info.ModTime(),
+	}
+}
+
+//upload copy localPath to remotePath, with all its content if it is a folder
+func upload(client *sshutils.Client, localPath, remotePath string) {
+	stat, e := os.Stat(localPath)
+	banai.PanicOnError(e)
+	if stat.IsDir() {
+		banai.PanicOnError(client.UploadDir(localPath, remotePath))
+		return
+	}
+	banai.PanicOnError(client.UploadFile(localPath, remotePath))
+}
+
+//download copy remotePath to localPath, with all its content if it is a folder
+func download(client *sshutils.Client, remotePath, localPath string) {
+	stat, e := client.Stat(remotePath)
+	banai.PanicOnError(e, "Remote", remotePath)
+	if stat.IsDir() {
+		banai.PanicOnError(client.DownloadDir(remotePath, localPath))
+		return
+	}
+	checkLocalFile(localPath)
+	banai.PanicOnError(client.Download(remotePath, localPath))
+}
+
+//fileMode the mode of chmod, a number like 0o755 or an octal string like "755"
+func fileMode(mode goja.Value) os.FileMode {
+	if s, isString := mode.Export().(string); isString {
+		n, e := strconv.ParseUint(s, 8, 32)
+		if e != nil {
+			banai.PanicOnError(fmt.Errorf("Invalid mode %s, expected an octal number like 755", s))
+		}
+		return os.FileMode(n)
+	}
+	return os.FileMode(mode.ToInteger())
+}
+
+//onRemoteHost connect to the host of sshConf, already resolved, and call fn with the connection
+func onRemoteHost(sshConf shellutils.ShellSSHConfig, fn func(client *sshutils.Client)) {
+	client, e := shellutils.DialSSH(sshConf)
+	banai.PanicOnError(e)
+	defer client.Close()
+	fn(client)
+}
+
+//sftpList list the items of a remote folder, sorted by name: sftpList(sshConf, remoteDir)
+func sftpList(sshConf shellutils.ShellSSHConfig, remoteDir string) []remoteFileInfo {
+	sshConf = resolveSSHConfig(sshConf)
+	var items []remoteFileInfo
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		items = listRemote(client, remoteDir)
+	})
+	return items
+}
+
+func listRemote(client *sshutils.Client, remoteDir string) []remoteFileInfo {
+	infos, e := client.List(remoteDir)
+	banai.PanicOnError(e, "Remote", remoteDir)
+	var items = make([]remoteFileInfo, 0, len(infos))
+	for _, info := range infos {
+		items = append(items, newRemoteFileInfo(info))
+	}
+	return items
+}
+
+//sftpStat information about a remote file or folder: sftpStat(sshConf, remotePath). Throws if it is not found
+func sftpStat(sshConf shellutils.ShellSSHConfig, remotePath string) remoteFileInfo {
+	sshConf = resolveSSHConfig(sshConf)
+	var info remoteFileInfo
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		info = statRemote(client, remotePath)
+	})
+	return info
+}
+
+func statRemote(client *sshutils.Client, remotePath string) remoteFileInfo {
+	info, e := client.Stat(remotePath)
+	banai.PanicOnError(e, "Remote", remotePath)
+	return newRemoteFileInfo(info)
+}
+
+//sftpMkdir create a remote folder and the folders above it that are missing: sftpMkdir(sshConf, remoteDir)
+func sftpMkdir(sshConf shellutils.ShellSSHConfig, remoteDir string) {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Create folder %s:%s", sshConf.Address, remoteDir) {
+		return
+	}
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		banai.PanicOnError(client.Mkdir(remoteDir), "Remote", remoteDir)
+	})
+}
+
+//sftpRemove remove a remote file, or a folder with all its content: sftpRemove(sshConf, remotePath)
+func sftpRemove(sshConf shellutils.ShellSSHConfig, remotePath string) {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Remove %s:%s", sshConf.Address, remotePath) {
+		return
+	}
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		banai.PanicOnError(client.Remove(remotePath), "Remote", remotePath)
+	})
+}
+
+//sftpChmod change the mode of a remote file or folder: sftpChmod(sshConf, remotePath, mode)
+func sftpChmod(sshConf shellutils.ShellSSHConfig, remotePath string, mode goja.Value) {
+	sshConf = resolveSSHConfig(sshConf)
+	var m = fileMode(mode)
+	if banai.SkipOnDryRun("Change mode of %s:%s to %o", sshConf.Address, remotePath, m) {
+		return
+	}
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		banai.PanicOnError(client.Chmod(remotePath, m), "Remote", remotePath)
+	})
+}
+
+//sftpRename rename a remote file or folder: sftpRename(sshConf, oldPath, newPath)
+func sftpRename(sshConf shellutils.ShellSSHConfig, oldPath, newPath string) {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Rename %s:%s to %s", sshConf.Address, oldPath, newPath) {
+		return
+	}
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		banai.PanicOnError(client.Rename(oldPath, newPath), "Remote", oldPath)
+	})
+}
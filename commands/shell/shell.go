@@ -6,11 +6,11 @@ import (
 	"os"
 	"strings"
 
+	"github.com/dop251/goja"
 	"github.com/sagiforbes/banai/infra"
 	"github.com/sagiforbes/banai/utils/shellutils"
 	"github.com/sagiforbes/banai/utils/sshutils"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh"
 )
 
 var logger *logrus.Logger
@@ -19,7 +19,7 @@ var banai *infra.Banai
 func envToMap() map[string]string {
 	var asMap = make(map[string]string)
 	var eqIdx int
-	for _, val := range os.Environ() {
+	for _, val := range append(os.Environ(), banai.Env...) {
 		eqIdx = strings.IndexRune(val, '=')
 		if eqIdx < 0 {
 			asMap[strings.TrimSpace(val)] = "1"
@@ -35,12 +35,47 @@ func envToMap() map[string]string {
 	return asMap
 }
 
-func callShell(cmd string, cmdOpt ...shellutils.CommandOptions) *shellutils.ShellResult {
-	var e error
+//scriptOptions the options of a command as a script passes them. onLine is a script function, which may return
+//anything. If it throws, the command is killed and the exception is thrown again once the command ended
+type scriptOptions struct {
+	shellutils.CommandOptions
+	OnLine func(line string, stream string) (goja.Value, error) `json:"onLine,omitempty"`
+}
 
-	var ret *shellutils.ShellResult
+//toCommandOptions the options of the commands of cmdOpt, with onLine failing the command when it throws
+func toCommandOptions(cmdOpt []scriptOptions) []shellutils.CommandOptions {
+	var opts = make([]shellutils.CommandOptions, 0, len(cmdOpt))
+	for _, o := range cmdOpt {
+		opt := o.CommandOptions
+		opt.OnLine = nil
+		if onLine := o.OnLine; onLine != nil {
+			opt.OnLine = func(line string, stream string) error {
+				_, err := onLine(line, stream)
+				return err
+			}
+		}
+		opts = append(opts, opt)
+	}
+	return opts
+}
+
+//panicOnRunError raise the error of running a command. An exception of onLine, or an interrupt of the script
+//while in onLine, is thrown again as it is
+func panicOnRunError(e error) {
+	switch err := e.(type) {
+	case *goja.Exception:
+		panic(err)
+	case *goja.InterruptedError:
+		panic(err)
+	}
+	banai.PanicOnError(e)
+}
+
+//commandOptions the options of a shell command, with the environment of the build and the secret they name
+func commandOptions(cmdOpt ...shellutils.CommandOptions) shellutils.CommandOptions {
+	var opt = shellutils.DefaultBashCommandOptions()
 	if cmdOpt != nil && len(cmdOpt) > 0 {
-		opt := cmdOpt[0]
+		opt = cmdOpt[0]
 		if opt.SecretID != "" {
 			secret, err := banai.GetSecret(opt.SecretID)
 			banai.PanicOnError(err)
@@ -50,28 +85,91 @@ func callShell(cmd string, cmdOpt ...shellutils.CommandOptions) *shellutils.Shel
 				if opt.Env == nil {
 					opt.Env = make([]string, 0)
 				}
-				opt.Env = append(opt.Env, fmt.Sprintf(`GIT_SSH_COMMAND="ssh -i %s -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no"`, s.PrivatekeyFile))
+				//Hosts are verified by the known_hosts of the user, so git never prompts for an unknown host
+				var hostKeyCheck = "-o StrictHostKeyChecking=yes"
+				if opt.InsecureIgnoreHostKey {
+					hostKeyCheck = "-o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no"
+				}
+				opt.Env = append(opt.Env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s %s", shellutils.ShellQuote(s.PrivatekeyFile), hostKeyCheck))
 
 			}
 
 		}
-		ret, e = shellutils.RunShellCommand(cmd, opt)
-	} else {
-		ret, e = shellutils.RunShellCommand(cmd)
 	}
-	banai.PanicOnError(e)
+	if !opt.ClearEnv {
+		opt.Env = append(append([]string{}, banai.Env...), opt.Env...)
+	}
+	opt.Output = banai.Out
+	opt.Track = banai.OnClose
+	return opt
+}
+
+//checkResult raise the failure of command, if opt asks to check it or by default after setShellCheck(true)
+func checkResult(command string, opt shellutils.CommandOptions, result *shellutils.ShellResult) {
+	var check = banai.ShellCheck
+	if opt.Check != nil {
+		check = *opt.Check
+	}
+	if check {
+		banai.PanicOnError(shellutils.CheckResult(command, result))
+	}
+}
+
+//callShell run cmd with the shell. name is how the command is called when it fails
+func callShell(name, cmd string, cmdOpt ...scriptOptions) *shellutils.ShellResult {
+	var e error
+
+	var ret *shellutils.ShellResult
+	opt := commandOptions(toCommandOptions(cmdOpt)...)
+	if banai.SkipOnDryRun("Run shell command: %s", cmd) {
+		return &shellutils.ShellResult{}
+	}
+	ret, e = shellutils.RunShellCommand(cmd, opt)
+	panicOnRunError(e)
+	checkResult(name, opt, ret)
 
 	return ret
 }
 
-func shellScript(scriptFile string, cmdOpt ...shellutils.CommandOptions) *shellutils.ShellResult {
+func shellScript(scriptFile string, cmdOpt ...scriptOptions) *shellutils.ShellResult {
 	fileContent, e := ioutil.ReadFile(scriptFile)
 	banai.PanicOnError(e)
-	return callShell(string(fileContent), cmdOpt...)
+	return callShell(scriptFile, string(fileContent), cmdOpt...)
 }
 
-func shell(cmd string, cmdOpt ...shellutils.CommandOptions) *shellutils.ShellResult {
-	return callShell(cmd, cmdOpt...)
+func shell(cmd string, cmdOpt ...scriptOptions) *shellutils.ShellResult {
+	return callShell(cmd, cmd, cmdOpt...)
+}
+
+//execute run a program with an argument list and without a shell, so nothing in the arguments is interpreted:
+//exec(program, [args], [opt]). The options and result are those of sh
+func execute(call goja.FunctionCall) goja.Value {
+	program := call.Argument(0).String()
+	if goja.IsUndefined(call.Argument(0)) || program == "" {
+		banai.PanicOnError(fmt.Errorf("exec has no program to run"))
+	}
+
+	var args = make([]string, 0)
+	var optArg = call.Argument(1)
+	if _, isArray := call.Argument(1).Export().([]interface{}); isArray {
+		banai.PanicOnError(banai.Jse.ExportTo(call.Argument(1), &args), "Arguments of", program)
+		optArg = call.Argument(2)
+	}
+	var cmdOpt = make([]scriptOptions, 0)
+	if !goja.IsUndefined(optArg) && !goja.IsNull(optArg) {
+		var opt scriptOptions
+		banai.PanicOnError(banai.Jse.ExportTo(optArg, &opt), "Options of", program)
+		cmdOpt = append(cmdOpt, opt)
+	}
+
+	opt := commandOptions(toCommandOptions(cmdOpt)...)
+	if banai.SkipOnDryRun("Run %s %q", program, args) {
+		return banai.Jse.ToValue(&shellutils.ShellResult{})
+	}
+	ret, err := shellutils.RunCommand(program, args, opt)
+	panicOnRunError(err)
+	checkResult(strings.Join(append([]string{program}, args...), " "), opt, ret)
+	return banai.Jse.ToValue(ret)
 }
 
 func updateSSHConfigBySecret(b *infra.Banai, secretID string, sshConf *shellutils.ShellSSHConfig) {
@@ -93,103 +191,74 @@ func updateSSHConfigBySecret(b *infra.Banai, secretID string, sshConf *shellutil
 		}
 
 	}
+	for i := range sshConf.JumpHosts {
+		updateSSHConfigBySecret(b, sshConf.JumpHosts[i].SecretID, &sshConf.JumpHosts[i])
+	}
 
 }
 
-func remoteshell(sshConf shellutils.ShellSSHConfig, cmd string) *shellutils.ShellResult {
-	var e error
-
+//resolveSSHConfig sshConf with the credentials of its secret and the settings of its host alias in the OpenSSH
+//config file. Fail if it is not enough to connect
+func resolveSSHConfig(sshConf shellutils.ShellSSHConfig) shellutils.ShellSSHConfig {
 	updateSSHConfigBySecret(banai, sshConf.SecretID, &sshConf)
-
-	var ret *shellutils.ShellResult
-
-	ret, e = shellutils.RunRemoteShell(sshConf, cmd)
+	resolved, e := sshConf.Resolve()
 	banai.PanicOnError(e)
-	return ret
+	banai.PanicOnError(resolved.Validate())
+	return resolved
 }
 
-func sshUploadFile(sshConf shellutils.ShellSSHConfig, localFile, remoteFile string) {
-	var e error
-
-	updateSSHConfigBySecret(banai, sshConf.SecretID, &sshConf)
-
-	if sshConf.Address == "" {
-		logger.Panic("sshConfig target host Address not set")
-	}
-	if sshConf.User == "" {
-		logger.Panic("sshConfig User not set")
+//remoteOptions the options of a remote command. The environment of the build is not sent, it belongs to the
+//local commands
+func remoteOptions(cmdOpt ...scriptOptions) shellutils.CommandOptions {
+	var opt shellutils.CommandOptions
+	if opts := toCommandOptions(cmdOpt); len(opts) > 0 {
+		opt = opts[0]
 	}
-
-	var sshClientConf *ssh.ClientConfig
-
-	if sshConf.Password != "" {
-		sshClientConf = sshutils.CreateFromUserPassword(sshConf.User, sshConf.Password)
-	} else {
-		if sshConf.PrivateKeyFile != "" {
-			sshClientConf, e = sshutils.CreateFromPrivateKeyFile(sshConf.User, sshConf.PrivateKeyFile, sshConf.Passphrase)
-			if e != nil {
-				logger.Panic(e)
-			}
-		}
-	}
-
-	var client *sshutils.Client
-	client, e = sshutils.Dial(sshConf.Address, sshClientConf)
-	banai.PanicOnError(e)
-
-	defer client.Close()
-
-	e = client.UploadFile(localFile, remoteFile)
-	banai.PanicOnError(e)
-
+	opt.Output = banai.Out
+	opt.Track = banai.OnClose
+	return opt
 }
 
-func sshDownloadFile(sshConf shellutils.ShellSSHConfig, remoteFile string, localFile string) {
-	var e error
-
-	updateSSHConfigBySecret(banai, sshConf.SecretID, &sshConf)
-
-	if stat, e := os.Stat(remoteFile); e != nil {
-		logger.Panic("Failed to open local file", e)
-	} else {
-		if stat.IsDir() {
-			logger.Panic("Local file is directory", e)
-		}
+func remoteshell(sshConf shellutils.ShellSSHConfig, cmd string, cmdOpt ...scriptOptions) *shellutils.ShellResult {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Run remote command on %s: %s", sshConf.Address, cmd) {
+		return &shellutils.ShellResult{}
 	}
 
-	var sshClientConf *ssh.ClientConfig
+	opt := remoteOptions(cmdOpt...)
+	ret, e := shellutils.RunRemoteShell(sshConf, cmd, opt)
+	panicOnRunError(e)
+	checkResult(cmd, opt, ret)
+	return ret
+}
 
-	if sshConf.Address == "" {
-		logger.Panic("sshConfig target host Address not set")
-	}
-	if sshConf.User == "" {
-		logger.Panic("sshConfig User not set")
+func sshUploadFile(sshConf shellutils.ShellSSHConfig, localFile, remoteFile string) {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Upload %s to %s:%s", localFile, sshConf.Address, remoteFile) {
+		return
 	}
 
-	if sshConf.Password != "" {
-		sshClientConf = sshutils.CreateFromUserPassword(sshConf.User, sshConf.Password)
-	} else {
-		if sshConf.PrivateKeyFile != "" {
-			sshClientConf, e = sshutils.CreateFromPrivateKeyFile(sshConf.User, sshConf.PrivateKeyFile, sshConf.Passphrase)
-			if e != nil {
-				logger.Panic(e)
-			}
-		}
-	}
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		upload(client, localFile, remoteFile)
+	})
+}
 
-	var client *sshutils.Client
-	client, e = sshutils.Dial(sshConf.Address, sshClientConf)
-	if e != nil {
-		logger.Panic(e)
+//checkLocalFile fail if localFile is a folder, which a remote file cannot be downloaded to
+func checkLocalFile(localFile string) {
+	if stat, e := os.Stat(localFile); e == nil && stat.IsDir() {
+		banai.PanicOnError(fmt.Errorf("Local file %s is a directory", localFile))
 	}
+}
 
-	defer client.Close()
-
-	e = client.Download(remoteFile, localFile)
-	if e != nil {
-		logger.Panic(e)
+func sshDownloadFile(sshConf shellutils.ShellSSHConfig, remoteFile string, localFile string) {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Download %s:%s to %s", sshConf.Address, remoteFile, localFile) {
+		return
 	}
 
+	onRemoteHost(sshConf, func(client *sshutils.Client) {
+		download(client, remoteFile, localFile)
+	})
 }
 
 func currentPath() string {
@@ -203,11 +272,16 @@ func changeDir(dir string) {
 }
 
 func print(text ...interface{}) {
-	fmt.Print(text...)
+	fmt.Fprint(banai.Out, text...)
 }
 
 func println(text ...interface{}) {
-	fmt.Println(text...)
+	fmt.Fprintln(banai.Out, text...)
+}
+
+//setShellCheck make check the default of sh, shScript, exec and rsh: setShellCheck(enabled)
+func setShellCheck(enabled bool) {
+	banai.ShellCheck = enabled
 }
 
 func exit(code int) {
@@ -224,10 +298,22 @@ func RegisterJSObjects(b *infra.Banai) {
 	banai.Jse.GlobalObject().Set("cd", changeDir)
 	banai.Jse.GlobalObject().Set("sh", shell)
 	banai.Jse.GlobalObject().Set("shScript", shellScript)
+	banai.Jse.GlobalObject().Set("shStart", shellStart)
+	banai.Jse.GlobalObject().Set("exec", execute)
 	banai.Jse.GlobalObject().Set("rsh", remoteshell)
 	banai.Jse.GlobalObject().Set("shUpload", sshUploadFile)
 	banai.Jse.GlobalObject().Set("shDownload", sshDownloadFile)
+	banai.Jse.GlobalObject().Set("sftpList", sftpList)
+	banai.Jse.GlobalObject().Set("sftpStat", sftpStat)
+	banai.Jse.GlobalObject().Set("sftpMkdir", sftpMkdir)
+	banai.Jse.GlobalObject().Set("sftpRemove", sftpRemove)
+	banai.Jse.GlobalObject().Set("sftpChmod", sftpChmod)
+	banai.Jse.GlobalObject().Set("sftpRename", sftpRename)
+	banai.Jse.GlobalObject().Set("sshConnect", sshConnect)
+	banai.Jse.GlobalObject().Set("sshTunnel", sshTunnel)
+	banai.Jse.GlobalObject().Set("sshReverseTunnel", sshReverseTunnel)
 	banai.Jse.GlobalObject().Set("print", print)
 	banai.Jse.GlobalObject().Set("println", println)
 	banai.Jse.GlobalObject().Set("exit", exit)
+	banai.Jse.GlobalObject().Set("setShellCheck", setShellCheck)
 }
@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"sync"
+
+	"github.com/sagiforbes/banai/utils/shellutils"
+	"github.com/sagiforbes/banai/utils/sshutils"
+)
+
+//sshTunnelHandle the object sshTunnel and sshReverseTunnel return to the script. It has no tunnel in a dry run
+type sshTunnelHandle struct {
+	LocalPort  int `json:"localPort"`
+	RemotePort int `json:"remotePort"`
+	tunnel     *sshutils.SSHtunnel
+	client     *sshutils.Client
+	closeOnce  sync.Once //The cleanup of an aborted build may close the tunnel while the script does
+}
+
+//Close stop forwarding, close the connections that were forwarded and the ssh connection. Closing it again does
+//nothing
+func (h *sshTunnelHandle) Close() {
+	if h.tunnel == nil {
+		return
+	}
+	h.closeOnce.Do(func() {
+		h.tunnel.Close()
+		h.client.Close()
+	})
+}
+
+//logTunnelError log a connection the tunnel failed to forward. The script goes on, as other connections may work
+func logTunnelError(err error) {
+	banai.Logger.Error(err)
+}
+
+//sshTunnel forward connections to localPort on the local host to remoteHost:remotePort, as the host of sshConf
+//sees it: sshTunnel(sshConf, localPort, remoteHost, remotePort). A localPort of 0 uses a free port. All the
+//forwarded connections share one ssh connection. The tunnel is closed when the script ends, if it was not before
+func sshTunnel(sshConf shellutils.ShellSSHConfig, localPort int, remoteHost string, remotePort int) *sshTunnelHandle {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Open tunnel from localhost:%d to %s:%d through %s", localPort, remoteHost, remotePort, sshConf.Address) {
+		return &sshTunnelHandle{LocalPort: localPort, RemotePort: remotePort}
+	}
+
+	client, e := shellutils.DialSSH(sshConf)
+	banai.PanicOnError(e)
+	tunnel, e := client.Tunnel(localPort, remoteHost, remotePort, logTunnelError)
+	if e != nil {
+		client.Close()
+		banai.PanicOnError(e)
+	}
+	h := &sshTunnelHandle{LocalPort: tunnel.Local.Port, RemotePort: remotePort, tunnel: tunnel, client: client}
+	banai.OnClose(h.Close)
+	banai.Logger.Info("Tunnel from localhost:", h.LocalPort, " to ", remoteHost, ":", remotePort, " through ", sshConf.Address)
+	return h
+}
+
+//sshReverseTunnel forward connections to remotePort on the host of sshConf, where it listens on localhost, to
+//localHost:localPort: sshReverseTunnel(sshConf, remotePort, localHost, localPort). A remotePort of 0 uses a port
+//the host chooses. The tunnel is closed when the script ends, if it was not before
+func sshReverseTunnel(sshConf shellutils.ShellSSHConfig, remotePort int, localHost string, localPort int) *sshTunnelHandle {
+	sshConf = resolveSSHConfig(sshConf)
+	if banai.SkipOnDryRun("Open reverse tunnel from %s:%d to %s:%d", sshConf.Address, remotePort, localHost, localPort) {
+		return &sshTunnelHandle{LocalPort: localPort, RemotePort: remotePort}
+	}
+
+	client, e := shellutils.DialSSH(sshConf)
+	banai.PanicOnError(e)
+	tunnel, e := client.ReverseTunnel("localhost", remotePort, localHost, localPort, logTunnelError)
+	if e != nil {
+		client.Close()
+		banai.PanicOnError(e)
+	}
+	h := &sshTunnelHandle{LocalPort: localPort, RemotePort: tunnel.Remote.Port, tunnel: tunnel, client: client}
+	banai.OnClose(h.Close)
+	banai.Logger.Info("Reverse tunnel from port ", h.RemotePort, " of ", sshConf.Address, " to ", localHost, ":", localPort)
+	return h
+}
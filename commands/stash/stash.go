@@ -0,0 +1,108 @@
+package stash
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/infra"
+	"github.com/sagiforbes/banai/utils/fsutils"
+)
+
+var banai *infra.Banai
+
+func exportPaths(v goja.Value) []string {
+	var paths = make([]string, 0)
+	if s, ok := v.Export().(string); ok {
+		paths = append(paths, s)
+	} else if err := banai.Jse.ExportTo(v, &paths); err != nil {
+		banai.PanicOnError(fmt.Errorf("Stashed paths must be a path, a glob or an array of them"))
+	}
+	return paths
+}
+
+//stash save files and folders under a name, so another target can unstash them: stash(name, pathsOrGlob)
+func stash(name string, pathsOrGlob goja.Value) []string {
+	paths := exportPaths(pathsOrGlob)
+	if banai.SkipOnDryRun("Stash %s as %s", strings.Join(paths, ", "), name) {
+		return []string{}
+	}
+	files, err := banai.Stash(name, paths)
+	banai.PanicOnError(err)
+	banai.Logger.Info("Stashed ", len(files), " files as ", name)
+	return files
+}
+
+//downloadTimeout how long downloading a stash from an agent may take
+const downloadTimeout = 10 * time.Minute
+
+//agentTokenEnv the environment variable with the bearer token of the agent a stash is downloaded from
+const agentTokenEnv = "BANAI_AGENT_TOKEN"
+
+//downloadStash unzip a stash that an agent serves at url into targetDir
+func downloadStash(url, targetDir string) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv(agentTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: downloadTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to download stash %s, status %s", url, res.Status)
+	}
+
+	f, err := ioutil.TempFile("", "banai-stash-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, res.Body)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download stash %s, %s", url, err)
+	}
+	return fsutils.Unzip(f.Name(), targetDir)
+}
+
+//unstash copy the files of a stash to targetDir: unstash(name, targetDir). name can also be the url of a stash
+//of an agent job, /jobs/{id}/stash/{name}, which is downloaded with the token in BANAI_AGENT_TOKEN
+func unstash(name string, targetDir ...string) []string {
+	var dir = "."
+	if len(targetDir) > 0 && targetDir[0] != "" {
+		dir = targetDir[0]
+	}
+	if banai.SkipOnDryRun("Unstash %s to %s", name, dir) {
+		return []string{}
+	}
+
+	var files []string
+	var err error
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		files, err = downloadStash(name, dir)
+	} else {
+		files, err = banai.Unstash(name, dir)
+	}
+	banai.PanicOnError(err)
+	banai.Logger.Info("Unstashed ", len(files), " files of ", name, " to ", dir)
+	return files
+}
+
+//RegisterJSObjects registers stash functions
+func RegisterJSObjects(b *infra.Banai) {
+	banai = b
+
+	banai.Jse.GlobalObject().Set("stash", stash)
+	banai.Jse.GlobalObject().Set("unstash", unstash)
+}
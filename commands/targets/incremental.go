@@ -0,0 +1,106 @@
+package targets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	hashImpl "github.com/sagiforbes/banai/commands/hash"
+	"github.com/sagiforbes/banai/infra"
+	"github.com/sagiforbes/banai/utils/fsutils"
+)
+
+//inputFiles the files that match the input globs of a target, without the files banai keeps in .banai
+func inputFiles(t *infra.Target) ([]string, error) {
+	files, err := fsutils.Glob(t.Inputs...)
+	if err != nil {
+		return nil, fmt.Errorf("Target %s inputs: %s", t.Name, err)
+	}
+	var ret = make([]string, 0, len(files))
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err == nil && strings.HasPrefix(abs, banai.TmpDir+string(filepath.Separator)) {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return ret, nil
+}
+
+//hashInputs hash the names and content of the input files, and the arguments the target is called with. Also
+//returns the latest modification time of the files
+func hashInputs(files []string, args []interface{}) (inputsHash string, latest time.Time, err error) {
+	hasher := sha256.New()
+	//Without arguments only the files are hashed
+	if len(args) > 0 {
+		encodedArgs, err := json.Marshal(args)
+		if err != nil {
+			return "", latest, err
+		}
+		fmt.Fprintf(hasher, "args\x00%s\n", encodedArgs)
+	}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		fileHash, err := hashImpl.FileSha256(f)
+		if err != nil {
+			return "", latest, err
+		}
+		fmt.Fprintf(hasher, "%s\x00%s\n", filepath.ToSlash(f), fileHash)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), latest, nil
+}
+
+//UpToDate check if an incremental target, called with args, can be skipped. It can, if all its outputs exist and the
+//hash of its inputs and args is the same as in its last successful run. If the target never ran, it can be skipped
+//if its outputs are newer than its inputs. inputsHash should be passed to TargetDone once the target runs
+func UpToDate(t *infra.Target, args []interface{}) (upToDate bool, inputsHash string, err error) {
+	if !t.Incremental() {
+		return false, "", nil
+	}
+	files, err := inputFiles(t)
+	if err != nil {
+		return false, "", err
+	}
+	inputsHash, latestInput, err := hashInputs(files, args)
+	if err != nil {
+		return false, "", fmt.Errorf("Target %s failed to hash its inputs, %s", t.Name, err)
+	}
+
+	var oldestOutput time.Time
+	for _, output := range t.Outputs {
+		info, err := os.Stat(output)
+		if err != nil {
+			return false, inputsHash, nil
+		}
+		if oldestOutput.IsZero() || info.ModTime().Before(oldestOutput) {
+			oldestOutput = info.ModTime()
+		}
+	}
+
+	if state, ok := banai.TargetState(t.Name); ok {
+		return state.InputsHash == inputsHash, inputsHash, nil
+	}
+	if len(t.Outputs) == 0 {
+		return false, inputsHash, nil
+	}
+	return oldestOutput.After(latestInput), inputsHash, nil
+}
+
+//TargetDone save the inputs hash of an incremental target that ended successfully, for the next runs to compare with
+func TargetDone(t *infra.Target, inputsHash string) error {
+	if !t.Incremental() || banai.DryRun {
+		return nil
+	}
+	return banai.SaveTargetState(t.Name, infra.TargetState{InputsHash: inputsHash, Ended: time.Now()})
+}
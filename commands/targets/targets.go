@@ -0,0 +1,134 @@
+package targets
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/infra"
+	"github.com/sagiforbes/banai/utils/cronutils"
+)
+
+var banai *infra.Banai
+
+func exportDeps(v goja.Value) []string {
+	var deps = make([]string, 0)
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return deps
+	}
+	err := banai.Jse.ExportTo(v, &deps)
+	if err != nil {
+		banai.PanicOnError(fmt.Errorf("Target dependencies must be an array of target names"))
+	}
+	return deps
+}
+
+//targetOpt options of a target, given instead of the deps array
+type targetOpt struct {
+	Deps    []string            `json:"deps,omitempty"`
+	Params  []infra.TargetParam `json:"params,omitempty"`
+	Inputs  []string            `json:"inputs,omitempty"`
+	Outputs []string            `json:"outputs,omitempty"`
+}
+
+func isArray(v goja.Value) bool {
+	obj, ok := v.(*goja.Object)
+	return ok && obj.ClassName() == "Array"
+}
+
+//exportDepsOrOpt read the second argument of target(), either an array of dependencies or a targetOpt object
+func exportDepsOrOpt(t *infra.Target, v goja.Value) {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) || isArray(v) {
+		t.Deps = exportDeps(v)
+		return
+	}
+	var opt targetOpt
+	err := banai.Jse.ExportTo(v, &opt)
+	if err != nil {
+		banai.PanicOnError(fmt.Errorf("Target %s options must be {deps, params, inputs, outputs}, %s", t.Name, err))
+	}
+	var names = make(map[string]bool)
+	for _, p := range opt.Params {
+		banai.PanicOnError(p.Validate())
+		if names[p.Name] {
+			banai.PanicOnError(fmt.Errorf("Target %s declares parameter %s twice", t.Name, p.Name))
+		}
+		names[p.Name] = true
+	}
+	t.Deps = opt.Deps
+	t.Params = opt.Params
+	t.Inputs = opt.Inputs
+	t.Outputs = opt.Outputs
+}
+
+//target declare a target: target(name, [deps], fn) or target(name, {deps, params}, fn). deps, options and fn are optional
+func target(call goja.FunctionCall) goja.Value {
+	t := &infra.Target{
+		Name: call.Argument(0).String(),
+	}
+
+	var fnArg goja.Value
+	switch len(call.Arguments) {
+	case 0, 1:
+	case 2:
+		if _, ok := goja.AssertFunction(call.Argument(1)); ok {
+			fnArg = call.Argument(1)
+		} else {
+			exportDepsOrOpt(t, call.Argument(1))
+		}
+	default:
+		exportDepsOrOpt(t, call.Argument(1))
+		fnArg = call.Argument(2)
+	}
+
+	if fnArg != nil && !goja.IsUndefined(fnArg) && !goja.IsNull(fnArg) {
+		fn, ok := goja.AssertFunction(fnArg)
+		if !ok {
+			banai.PanicOnError(fmt.Errorf("Target %s body must be a function", t.Name))
+		}
+		t.Fn = fn
+	}
+
+	banai.PanicOnError(banai.AddTarget(t))
+	return goja.Undefined()
+}
+
+type scheduleOpt struct {
+	Overlap string `json:"overlap,omitempty"`
+	Missed  string `json:"missed,omitempty"`
+}
+
+//schedule declare a target to run on a cron schedule, when banai runs as agent: schedule(cron, targetName, opt)
+func schedule(cron string, targetName string, opt ...scheduleOpt) {
+	_, err := cronutils.Parse(cron)
+	banai.PanicOnError(err)
+	if targetName == "" {
+		banai.PanicOnError(fmt.Errorf("Scheduled target name is empty"))
+	}
+
+	s := infra.ScheduledRun{
+		Cron:   cron,
+		Target: targetName,
+	}
+	if len(opt) > 0 {
+		s.Overlap = opt[0].Overlap
+		s.Missed = opt[0].Missed
+	}
+	banai.AddSchedule(s)
+}
+
+//describe set the description of a target or a top level function, as listed by banai -l: describe(name, text)
+func describe(name string, description string) {
+	if name == "" {
+		banai.PanicOnError(fmt.Errorf("Described name is empty"))
+	}
+	banai.Describe(name, description)
+}
+
+//RegisterJSObjects registers target declaration functions
+func RegisterJSObjects(b *infra.Banai) {
+	banai = b
+
+	banai.Jse.GlobalObject().Set("target", target)
+	banai.Jse.GlobalObject().Set("schedule", schedule)
+	banai.Jse.GlobalObject().Set("describe", describe)
+}
@@ -3,6 +3,7 @@ module github.com/sagiforbes/banai
 go 1.15
 
 require (
+	github.com/creack/pty v1.1.11
 	github.com/dlclark/regexp2 v1.4.0 // indirect
 	github.com/dop251/goja v0.0.0-20210216182323-60bc6ebb9fc1
 	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
@@ -11,5 +12,4 @@ require (
 	github.com/sirupsen/logrus v1.8.0
 	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-
 )
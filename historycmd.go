@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sagiforbes/banai/agent"
+)
+
+const historyCommand = "history"
+
+//runHistoryCommand implements: banai history [list flags] | banai history show [-agent-dir dir] <run id>
+func runHistoryCommand(args []string) error {
+	if len(args) > 0 && args[0] == "show" {
+		return showHistoryRun(args[1:])
+	}
+
+	var query agent.RunQuery
+	var agentDir string
+	flags := flag.NewFlagSet("banai history", flag.ExitOnError)
+	flags.StringVar(&agentDir, "agent-dir", defaultAgentDir, "The folder of the agent")
+	flags.StringVar(&query.Status, "status", "", "Show only runs with this status")
+	flags.StringVar(&query.Target, "target", "", "Show only runs of this target")
+	flags.IntVar(&query.Limit, "n", 20, "Maximum number of runs to show. 0 shows all")
+	flags.Parse(args)
+
+	history, err := agent.OpenHistory(agent.HistoryFolder(agentDir))
+	if err != nil {
+		return err
+	}
+	runs, err := history.List(query)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSTARTED\tDURATION\tTARGETS")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", run.ID, run.Status, formatRunTime(run.Started),
+			runDuration(run), strings.Join(run.Targets, ","))
+	}
+	return w.Flush()
+}
+
+func showHistoryRun(args []string) error {
+	var agentDir string
+	flags := flag.NewFlagSet("banai history show", flag.ExitOnError)
+	flags.StringVar(&agentDir, "agent-dir", defaultAgentDir, "The folder of the agent")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: banai history show [-agent-dir dir] <run id>")
+	}
+
+	history, err := agent.OpenHistory(agent.HistoryFolder(agentDir))
+	if err != nil {
+		return err
+	}
+	run, err := history.Get(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	log, err := history.Log(run.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ID:         ", run.ID)
+	fmt.Println("Status:     ", run.Status)
+	fmt.Println("Targets:    ", strings.Join(run.Targets, ","))
+	fmt.Println("Script hash:", run.ScriptHash)
+	fmt.Println("Started:    ", formatRunTime(run.Started))
+	fmt.Println("Ended:      ", formatRunTime(run.Ended))
+	fmt.Println("Duration:   ", runDuration(run))
+	if run.Value != "" {
+		fmt.Println("Value:      ", run.Value)
+	}
+	if run.Error != "" {
+		fmt.Println("Error:      ", run.Error)
+	}
+	fmt.Println("---------------------------------- log ----------------------------------")
+	os.Stdout.Write(log)
+	return nil
+}
+
+func formatRunTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func runDuration(run agent.Run) string {
+	if run.Started.IsZero() || run.Ended.IsZero() {
+		return "-"
+	}
+	return run.Ended.Sub(run.Started).Round(time.Millisecond).String()
+}
@@ -0,0 +1,54 @@
+package infra
+
+import (
+	"sort"
+	"sync"
+)
+
+//cleanups what must be released when the script ends, e.g. the processes it started in the background
+type cleanups struct {
+	mutex   sync.Mutex //Guards funcs and next
+	running sync.Mutex //Held while the functions run, so a second Cleanup returns only after they ended
+	funcs   map[int]func()
+	next    int //The id of the next function, so they run last first
+}
+
+//OnClose run fn when the script ends, by Close or by Cleanup. Call the returned function once what fn releases
+//is gone, so fn does not run
+func (b *Banai) OnClose(fn func()) (remove func()) {
+	b.cleanups.mutex.Lock()
+	defer b.cleanups.mutex.Unlock()
+	if b.cleanups.funcs == nil {
+		b.cleanups.funcs = make(map[int]func())
+	}
+	var id = b.cleanups.next
+	b.cleanups.next++
+	b.cleanups.funcs[id] = fn
+	return func() {
+		b.cleanups.mutex.Lock()
+		defer b.cleanups.mutex.Unlock()
+		delete(b.cleanups.funcs, id)
+	}
+}
+
+//Cleanup run the functions given to OnClose, last first, and forget them. Aborting a build calls it, so a script
+//waiting for a process it started is released. The functions run without holding the lock of OnClose, since
+//stopping a process can take seconds
+func (b *Banai) Cleanup() {
+	b.cleanups.running.Lock()
+	defer b.cleanups.running.Unlock()
+
+	b.cleanups.mutex.Lock()
+	var funcs = b.cleanups.funcs
+	b.cleanups.funcs = nil
+	b.cleanups.mutex.Unlock()
+
+	var ids = make([]int, 0, len(funcs))
+	for id := range funcs {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	for _, id := range ids {
+		funcs[id]()
+	}
+}
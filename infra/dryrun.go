@@ -0,0 +1,20 @@
+package infra
+
+import "fmt"
+
+//SkipOnDryRun record a call with side effects, described by format and a, when the build is a dry run.
+//Returns true if the call must not run, so the caller returns a stub result instead
+func (b *Banai) SkipOnDryRun(format string, a ...interface{}) bool {
+	if !b.DryRun {
+		return false
+	}
+	call := fmt.Sprintf(format, a...)
+	b.dryRunCalls = append(b.dryRunCalls, call)
+	b.Logger.Info("[dry-run] ", call)
+	return true
+}
+
+//DryRunCalls the calls skipped by the dry run, in the order they were made
+func (b *Banai) DryRunCalls() []string {
+	return append([]string{}, b.dryRunCalls...)
+}
@@ -3,6 +3,7 @@ package infra
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -18,26 +19,53 @@ var ErrSecretNotFound = errors.New("Secret not found")
 
 //Banai banai main struct
 type Banai struct {
-	Jse          *goja.Runtime
-	TmpDir       string
-	Logger       *logrus.Logger
-	stashFolder  string
-	secretFolder string
+	Jse            *goja.Runtime
+	TmpDir         string
+	Logger         *logrus.Logger
+	Out            io.Writer //Where the script prints to
+	Env            []string  //Environment variables, as KEY=VALUE, added to the env object and to the commands the script runs
+	DryRun         bool      //When true, functions with side effects log what they would do instead of doing it
+	CacheDir       string    //Where cache() keeps its entries, across runs
+	CacheSizeLimit int64     //Maximal size, in bytes, of all cache entries. Least recently used entries are removed above it
+	KeepStash      bool      //Do not remove the stashes on Close, so they can be downloaded after the build ends
+	ShellCheck     bool      //When true, shell commands that exit with a code other than 0 fail unless their check option is false
+	stashFolder    string
+	secretFolder   string
+	stateFolder    string //What banai keeps between runs, e.g. the inputs hash of incremental targets
 
 	secrets map[string]secretStruct
+	worker  bool
+
+	targets      map[string]*Target
+	targetNames  []string
+	schedules    []ScheduledRun
+	descriptions map[string]string
+	dryRunCalls  []string
+	cleanups     *cleanups
+}
+
+const (
+	tmpDirName      = ".banai"
+	stashFolderName = "stash"
+)
+
+//DefaultCacheSizeLimit the default size limit of the cache
+const DefaultCacheSizeLimit = 10 * 1024 * 1024 * 1024
+
+//DefaultCacheDir the folder of the cache, $BANAI_CACHE_DIR or banai under the user cache folder
+func DefaultCacheDir() string {
+	if dir := os.Getenv("BANAI_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "banai")
+	}
+	return filepath.Join(os.TempDir(), "banai-cache")
 }
 
 //NewBanai create new banai struct object
 func NewBanai() *Banai {
-	ret := &Banai{
-		Jse:     goja.New(),
-		Logger:  logrus.New(),
-		secrets: make(map[string]secretStruct),
-	}
-	ret.Jse.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
-	ret.TmpDir, _ = filepath.Abs("./.banai")
-	ret.stashFolder = filepath.Join(ret.TmpDir, "stash")
-	ret.secretFolder = filepath.Join(ret.TmpDir, "sec")
+	ret := newBanai()
 	os.RemoveAll(ret.stashFolder)
 	os.MkdirAll(ret.stashFolder, 0700)
 	os.RemoveAll(ret.secretFolder)
@@ -46,6 +74,44 @@ func NewBanai() *Banai {
 	return ret
 }
 
+//NewWorkerBanai create banai struct object for a worker process that runs targets on behalf of a parent banai.
+//The worker shares the .banai folder of its parent, so it does not clear it on start nor remove it on Close
+func NewWorkerBanai() *Banai {
+	ret := newBanai()
+	ret.worker = true
+	os.MkdirAll(ret.stashFolder, 0700)
+	os.MkdirAll(ret.secretFolder, 0700)
+
+	return ret
+}
+
+func newBanai() *Banai {
+	ret := &Banai{
+		Jse:          goja.New(),
+		Logger:       logrus.New(),
+		Out:          os.Stdout,
+		secrets:      make(map[string]secretStruct),
+		targets:      make(map[string]*Target),
+		descriptions: make(map[string]string),
+		cleanups:     &cleanups{},
+	}
+	ret.CacheDir = DefaultCacheDir()
+	ret.CacheSizeLimit = DefaultCacheSizeLimit
+	ret.Jse.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	ret.TmpDir, _ = filepath.Abs(tmpDirName)
+	ret.stashFolder = filepath.Join(ret.TmpDir, stashFolderName)
+	ret.secretFolder = filepath.Join(ret.TmpDir, "sec")
+	ret.stateFolder = filepath.Join(ret.TmpDir, "state")
+
+	return ret
+}
+
+//SetOutput send both the log and the printed output of the script to out
+func (b *Banai) SetOutput(out io.Writer) {
+	b.Out = out
+	b.Logger.SetOutput(out)
+}
+
 //PanicOnError return Value typed panic so javascript will get exception
 func (b Banai) PanicOnError(e error, t ...string) {
 	if e != nil {
@@ -66,7 +132,16 @@ func (b Banai) PanicOnError(e error, t ...string) {
 
 //Close should be call at the end of using banai to remove all allocated resource during banai execution
 func (b Banai) Close() {
-	os.RemoveAll(b.TmpDir)
+	b.Cleanup()
+	if b.worker {
+		return
+	}
+	if !b.KeepStash {
+		os.RemoveAll(b.stashFolder)
+	}
+	os.RemoveAll(b.secretFolder)
+	//Removed only if no state is kept
+	os.Remove(b.TmpDir)
 
 }
 
@@ -80,7 +155,7 @@ func (b Banai) Save(fileName string) (string, error) {
 	}
 	stashID := uuid.NewString()
 
-	e = fsutils.CopyfsItem(abs, stashID)
+	e = fsutils.CopyfsItem(abs, filepath.Join(b.stashFolder, stashID))
 	if e != nil {
 		return "", e
 	}
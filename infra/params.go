@@ -0,0 +1,97 @@
+package infra
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Parameter types of a target parameter
+const (
+	ParamTypeString  = "string"
+	ParamTypeNumber  = "number"
+	ParamTypeBoolean = "boolean"
+)
+
+//TargetParam a parameter a target declares. Values come from the command line as -p name=value
+//or as target:value1,value2
+type TargetParam struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type,omitempty"` //One of string, number or boolean. Default is string
+	Default     interface{} `json:"default,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+//Validate check the parameter declaration
+func (p TargetParam) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("Parameter name is empty")
+	}
+	switch p.Type {
+	case "", ParamTypeString, ParamTypeNumber, ParamTypeBoolean:
+		return nil
+	}
+	return fmt.Errorf("Parameter %s has unknown type %s", p.Name, p.Type)
+}
+
+//Convert a command line value to the type of the parameter
+func (p TargetParam) Convert(value string) (interface{}, error) {
+	switch p.Type {
+	case ParamTypeNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %s must be a number, got %q", p.Name, value)
+		}
+		return f, nil
+	case ParamTypeBoolean:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %s must be a boolean, got %q", p.Name, value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+//ParamValues resolve the values of the target parameters. args are the values given to the target as
+//target:arg1,arg2, params are the -p name=value values. Returns the value of every declared parameter by
+//its name, and the arguments to call the target function with
+func (t *Target) ParamValues(args []string, params map[string]string) (map[string]interface{}, []interface{}, error) {
+	var values = make(map[string]interface{})
+	var callArgs = make([]interface{}, 0)
+
+	if len(t.Params) == 0 {
+		for _, arg := range args {
+			callArgs = append(callArgs, arg)
+		}
+		return values, callArgs, nil
+	}
+
+	if len(args) > len(t.Params) {
+		return nil, nil, fmt.Errorf("Target %s takes %d arguments, got %d", t.Name, len(t.Params), len(args))
+	}
+
+	for i, p := range t.Params {
+		var value interface{}
+		var err error
+		raw, ok := params[p.Name]
+		if i < len(args) {
+			raw, ok = args[i], true
+		}
+		switch {
+		case ok:
+			value, err = p.Convert(raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Target %s: %s", t.Name, err)
+			}
+		case p.Required:
+			return nil, nil, fmt.Errorf("Target %s: parameter %s is required", t.Name, p.Name)
+		default:
+			value = p.Default
+		}
+		values[p.Name] = value
+		callArgs = append(callArgs, value)
+	}
+	return values, callArgs, nil
+}
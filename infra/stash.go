@@ -0,0 +1,103 @@
+package infra
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sagiforbes/banai/utils/fsutils"
+)
+
+//StashFolderOf the folder of a named stash, of banai that runs in workDir
+func StashFolderOf(workDir, name string) string {
+	return filepath.Join(workDir, tmpDirName, stashFolderName, url.PathEscape(name))
+}
+
+func (b *Banai) namedStashFolder(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("Stash name is empty")
+	}
+	return filepath.Join(b.stashFolder, url.PathEscape(name)), nil
+}
+
+//Stash save files, and the files of folders, under a named stash, replacing what was stashed by that name.
+//Paths must be relative to the working folder, and are kept with their folders. The files banai keeps in .banai,
+//such as the keys of secrets and the stashes, are never stashed. Returns the stashed files, and fails if there are none
+func (b *Banai) Stash(name string, paths []string) ([]string, error) {
+	dir, err := b.namedStashFolder(name)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := fsutils.Glob(paths...)
+	if err != nil {
+		return nil, err
+	}
+	var files = make([]string, 0, len(matched))
+	for _, f := range matched {
+		abs, err := filepath.Abs(f)
+		if err == nil && strings.HasPrefix(abs, b.TmpDir+string(filepath.Separator)) {
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Stash %s has no files, %s matched none", name, strings.Join(paths, ", "))
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		rel := filepath.Clean(f)
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("Cannot stash %s, stashed files must be under the working folder", f)
+		}
+		dest := filepath.Join(dir, rel)
+		if err = os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return nil, err
+		}
+		if _, err = fsutils.CopyTree(f, dest); err != nil {
+			return nil, fmt.Errorf("Failed to stash %s, %s", f, err)
+		}
+	}
+	return files, nil
+}
+
+//Unstash copy the files of a named stash to targetDir, in the folders they were stashed from. Returns the restored files
+func (b *Banai) Unstash(name, targetDir string) ([]string, error) {
+	dir, err := b.namedStashFolder(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("Stash %s not found", name)
+	}
+	if targetDir == "" {
+		targetDir = "."
+	}
+
+	var restored = make([]string, 0)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(targetDir, rel)
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if _, err = fsutils.CopyTree(path, dest); err != nil {
+			return err
+		}
+		restored = append(restored, dest)
+		return nil
+	})
+	return restored, err
+}
@@ -0,0 +1,169 @@
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+//Target a named unit of work declared in the Banaifile by the target() function
+type Target struct {
+	Name    string
+	Deps    []string
+	Params  []TargetParam //Parameters the target takes, in the order they are passed to Fn
+	Inputs  []string      //Glob patterns of the files the target reads. Declared for incremental targets
+	Outputs []string      //Files the target creates. Declared for incremental targets
+	Fn      goja.Callable
+}
+
+//Incremental true if the target can be skipped when it is up to date
+func (t *Target) Incremental() bool {
+	return len(t.Inputs) > 0 || len(t.Outputs) > 0
+}
+
+//TargetState what banai keeps about the last successful run of an incremental target
+type TargetState struct {
+	InputsHash string    `json:"inputsHash"`
+	Ended      time.Time `json:"ended"`
+}
+
+func (b *Banai) targetStateFile(name string) string {
+	return filepath.Join(b.stateFolder, "targets", url.PathEscape(name)+".json")
+}
+
+//TargetState the state saved by the last successful run of a target. ok is false if the target never ran
+func (b *Banai) TargetState(name string) (state TargetState, ok bool) {
+	content, err := ioutil.ReadFile(b.targetStateFile(name))
+	if err != nil {
+		return
+	}
+	ok = json.Unmarshal(content, &state) == nil
+	return
+}
+
+//SaveTargetState keep the state of a target run, in the .banai folder, for the next runs
+func (b *Banai) SaveTargetState(name string, state TargetState) error {
+	fileName := b.targetStateFile(name)
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, content, 0644)
+}
+
+//AddTarget register a target. A target name can be declared only once
+func (b *Banai) AddTarget(t *Target) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("Target name is empty")
+	}
+	if _, ok := b.targets[t.Name]; ok {
+		return fmt.Errorf("Target %s already declared", t.Name)
+	}
+	b.targets[t.Name] = t
+	b.targetNames = append(b.targetNames, t.Name)
+	return nil
+}
+
+//GetTarget return a declared target. If no target was declared by that name but a top level function
+//exists in the script, a target without dependencies that calls that function is returned
+func (b *Banai) GetTarget(name string) (*Target, bool) {
+	if t, ok := b.targets[name]; ok {
+		return t, true
+	}
+	if fn, ok := goja.AssertFunction(b.Jse.Get(name)); ok {
+		return &Target{Name: name, Fn: fn}, true
+	}
+	return nil, false
+}
+
+//TargetNames names of all declared targets in the order they were declared
+func (b *Banai) TargetNames() []string {
+	return append([]string{}, b.targetNames...)
+}
+
+//Describe set the description of a target or a top level function, as shown by banai -l
+func (b *Banai) Describe(name, description string) {
+	b.descriptions[name] = description
+}
+
+//Description the description of a target or a top level function set by Describe. Empty if none was set
+func (b *Banai) Description(name string) string {
+	return b.descriptions[name]
+}
+
+//ResolveTargets return the targets to run, ordered so each target comes after all its dependencies.
+//Each target appears once even if required by several other targets
+func (b *Banai) ResolveTargets(names []string) ([]*Target, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var state = make(map[string]int)
+	var ret = make([]*Target, 0)
+	var path = make([]string, 0)
+
+	var visit func(name, requiredBy string) error
+	visit = func(name, requiredBy string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("Dependency cycle found: %s -> %s", strings.Join(path, " -> "), name)
+		}
+
+		t, ok := b.GetTarget(name)
+		if !ok {
+			if requiredBy != "" {
+				return fmt.Errorf("Target %s not found (required by %s)", name, requiredBy)
+			}
+			return fmt.Errorf("Target %s not found", name)
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range t.Deps {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		ret = append(ret, t)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+//ScheduledRun a target the Banaifile asks to run on a cron schedule, declared by the schedule() function
+type ScheduledRun struct {
+	Cron    string
+	Target  string
+	Overlap string //What to do when the previous run did not end yet. Empty for the default
+	Missed  string //What to do with runs missed while banai was down. Empty for the default
+}
+
+//AddSchedule register a scheduled run of a target
+func (b *Banai) AddSchedule(s ScheduledRun) {
+	b.schedules = append(b.schedules, s)
+}
+
+//Schedules all scheduled runs declared by the script
+func (b *Banai) Schedules() []ScheduledRun {
+	return append([]ScheduledRun{}, b.schedules...)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/infra"
+)
+
+var (
+	//A JSDoc comment followed by a function declaration or a target() call
+	jsDocRegexp = regexp.MustCompile(`/\*\*((?:[^*]|\*+[^*/])*)\*+/\s*(?:function\s+([A-Za-z_$][\w$]*)|target\(\s*["']([^"']+)["'])`)
+	//A function declared at the start of a line, with its parameter names
+	topLevelFunctionRegexp = regexp.MustCompile(`(?m)^function\s+([A-Za-z_$][\w$]*)\s*\(([^)]*)\)`)
+	//@param {type} name description
+	jsDocParamRegexp = regexp.MustCompile(`^@param\s+(?:\{([^}]*)\}\s*)?\[?([A-Za-z_$][\w$]*)\S*\s*-?\s*(.*)$`)
+)
+
+//scriptDoc the JSDoc comment of a function or a target
+type scriptDoc struct {
+	Text   string
+	Params map[string]infra.TargetParam
+}
+
+//parseJSDoc read the description and @param tags of a JSDoc comment body
+func parseJSDoc(comment string) scriptDoc {
+	doc := scriptDoc{Params: make(map[string]infra.TargetParam)}
+	var text = make([]string, 0)
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "*"))
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "@") {
+			text = append(text, line)
+			continue
+		}
+		if m := jsDocParamRegexp.FindStringSubmatch(line); m != nil {
+			doc.Params[m[2]] = infra.TargetParam{Name: m[2], Type: m[1], Description: m[3]}
+		}
+	}
+	doc.Text = strings.Join(text, " ")
+	return doc
+}
+
+//scriptDocs the JSDoc comments of the script by the function or target name they describe
+func scriptDocs(script string) map[string]scriptDoc {
+	var docs = make(map[string]scriptDoc)
+	for _, m := range jsDocRegexp.FindAllStringSubmatch(script, -1) {
+		name := m[2]
+		if name == "" {
+			name = m[3]
+		}
+		docs[name] = parseJSDoc(m[1])
+	}
+	return docs
+}
+
+//topLevelFunctions names of the functions declared at the top level of the script, in the order they are
+//declared, with their parameter names
+func topLevelFunctions(script string) (names []string, params map[string][]string) {
+	params = make(map[string][]string)
+	for _, m := range topLevelFunctionRegexp.FindAllStringSubmatch(script, -1) {
+		if _, ok := params[m[1]]; ok {
+			continue
+		}
+		names = append(names, m[1])
+		params[m[1]] = make([]string, 0)
+		for _, p := range strings.Split(m[2], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				params[m[1]] = append(params[m[1]], p)
+			}
+		}
+	}
+	return
+}
+
+func formatParam(p infra.TargetParam) string {
+	var attrs = make([]string, 0)
+	if p.Type != "" {
+		attrs = append(attrs, p.Type)
+	}
+	if p.Required {
+		attrs = append(attrs, "required")
+	}
+	if p.Default != nil {
+		attrs = append(attrs, fmt.Sprint("default ", p.Default))
+	}
+	s := "param " + p.Name
+	if len(attrs) > 0 {
+		s += " (" + strings.Join(attrs, ", ") + ")"
+	}
+	if p.Description != "" {
+		s += ": " + p.Description
+	}
+	return s
+}
+
+//writeListEntry write a target or a function, its description, dependencies and parameters
+func writeListEntry(w io.Writer, name, description string, deps []string, params []infra.TargetParam) {
+	var lines = make([]string, 0)
+	if description != "" {
+		lines = append(lines, description)
+	}
+	if len(deps) > 0 {
+		lines = append(lines, "depends on: "+strings.Join(deps, ", "))
+	}
+	for _, p := range params {
+		lines = append(lines, formatParam(p))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "")
+	}
+	if name == mainFuncName {
+		name += " (default)"
+	}
+	fmt.Fprintf(w, "  %s\t%s\n", name, lines[0])
+	for _, line := range lines[1:] {
+		fmt.Fprintf(w, "  \t%s\n", line)
+	}
+}
+
+//listTargets print the targets and the top level functions of a script, with their description,
+//dependencies and parameters. Descriptions are set by describe() or by a JSDoc comment
+func listTargets(scriptFileName string, out io.Writer) (err error) {
+	scriptFileName = resolveScriptFileName(scriptFileName)
+	var b = infra.NewBanai()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		b.Close()
+	}()
+
+	//The top level of the script runs to register the targets. Listing never has its side effects
+	b.DryRun = true
+	b.Jse.GlobalObject().Set(paramsObjectName, cliParamsObject(nil))
+	if err = loadProgram(b, scriptFileName); err != nil {
+		return err
+	}
+	script := loadScript(scriptFileName)
+	docs := scriptDocs(script)
+	functionNames, functionParams := topLevelFunctions(script)
+
+	describe := func(name string) string {
+		if d := b.Description(name); d != "" {
+			return d
+		}
+		return docs[name].Text
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 3, ' ', 0)
+	targetNames := b.TargetNames()
+	if len(targetNames) > 0 {
+		fmt.Fprintln(w, "Targets:\t")
+	}
+	for _, name := range targetNames {
+		t, _ := b.GetTarget(name)
+		var params = make([]infra.TargetParam, 0, len(t.Params))
+		for _, p := range t.Params {
+			if p.Type == "" {
+				p.Type = infra.ParamTypeString
+			}
+			if p.Description == "" {
+				p.Description = docs[name].Params[p.Name].Description
+			}
+			params = append(params, p)
+		}
+		writeListEntry(w, name, describe(name), t.Deps, params)
+	}
+
+	var functionsTitle bool
+	for _, name := range functionNames {
+		if _, ok := goja.AssertFunction(b.Jse.Get(name)); !ok || containsName(targetNames, name) {
+			continue
+		}
+		if !functionsTitle {
+			fmt.Fprintln(w, "Functions:\t")
+			functionsTitle = true
+		}
+		var params = make([]infra.TargetParam, 0)
+		for _, p := range functionParams[name] {
+			param, ok := docs[name].Params[p]
+			if !ok {
+				param = infra.TargetParam{Name: p}
+			}
+			params = append(params, param)
+		}
+		writeListEntry(w, name, describe(name), nil, params)
+	}
+	if len(targetNames) == 0 && !functionsTitle {
+		fmt.Fprintln(w, "No targets or functions found in", scriptFileName)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	//Entries without a description end with the padding of the name column
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if _, err = io.WriteString(out, strings.TrimRight(line, " ")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/dop251/goja"
 	"github.com/sagiforbes/banai/commands/archive"
+	"github.com/sagiforbes/banai/commands/cache"
 	"github.com/sagiforbes/banai/commands/fs"
 	hashImpl "github.com/sagiforbes/banai/commands/hash"
 	"github.com/sagiforbes/banai/commands/httpclient"
 	secret "github.com/sagiforbes/banai/commands/secrets"
 	"github.com/sagiforbes/banai/commands/shell"
+	"github.com/sagiforbes/banai/commands/stash"
+	"github.com/sagiforbes/banai/commands/targets"
 	"github.com/sagiforbes/banai/infra"
 )
 
@@ -35,10 +43,8 @@ func loadScript(fileName string) string {
 	return string(b)
 }
 
-func loadSecrets(secretsFile string, b *infra.Banai) (err error) {
-	if secretsFile == "" {
-		return nil
-	}
+//readSecretsFile read the secret objects of a secrets file
+func readSecretsFile(secretsFile string) (secrets []map[string]interface{}, err error) {
 	var fileContent []byte
 	fileContent, err = ioutil.ReadFile(secretsFile)
 	if err != nil {
@@ -57,101 +63,344 @@ func loadSecrets(secretsFile string, b *infra.Banai) (err error) {
 		return
 	}
 
-	var secretObjectInter map[string]interface{}
-	secretsInterfaces := intr.([]interface{})
-	var secretTypeInter interface{}
-	var secretType string
-
-	for _, secretInterface := range secretsInterfaces {
-		secretObjectInter = secretInterface.(map[string]interface{})
-		secretTypeInter, ok = secretObjectInter["type"]
-		secretType = secretTypeInter.(string)
-		if ok {
-			switch secretType {
-			case "text":
-				b.AddStringSecret(secretObjectInter["id"].(string), secretObjectInter["text"].(string))
-			case "ssh":
-				b.AddSSHWithPrivate(secretObjectInter["id"].(string),
-					secretObjectInter["user"].(string),
-					secretObjectInter["privateKey"].(string),
-					secretObjectInter["passphrase"].(string))
-			case "userpass":
-				b.AddUserPassword(secretObjectInter["id"].(string),
-					secretObjectInter["user"].(string),
-					secretObjectInter["password"].(string))
+	items, ok := intr.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Secrets file %s: secrets must be a list", secretsFile)
+	}
+	for i, secretInterface := range items {
+		secret, ok := secretInterface.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Secrets file %s: secret %d is not an object", secretsFile, i+1)
+		}
+		secrets = append(secrets, secret)
+	}
+	return
+}
+
+//secretString the string field of the secret at index of a secrets file. Only an optional field may be missing
+func secretString(secret map[string]interface{}, index int, field string, optional bool) (string, error) {
+	value, found := secret[field]
+	if !found && optional {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("Secret %d: %s must be a string", index+1, field)
+	}
+	return s, nil
+}
+
+func loadSecrets(secretsFile string, b *infra.Banai) (err error) {
+	if secretsFile == "" {
+		return nil
+	}
+
+	var secretsInterfaces []map[string]interface{}
+	secretsInterfaces, err = readSecretsFile(secretsFile)
+	if err != nil {
+		return
+	}
+
+	for i, secretObjectInter := range secretsInterfaces {
+		//The fields of each type, all strings. The passphrase of a private key is optional
+		var fields []string
+		var optional = map[string]bool{"passphrase": true}
+		secretType, err := secretString(secretObjectInter, i, "type", false)
+		if err != nil {
+			return fmt.Errorf("Secrets file %s: %v", secretsFile, err)
+		}
+		switch secretType {
+		case "text":
+			fields = []string{"id", "text"}
+		case "ssh":
+			fields = []string{"id", "user", "privateKey", "passphrase"}
+		case "userpass":
+			fields = []string{"id", "user", "password"}
+		default:
+			continue
+		}
+		var values = make([]string, len(fields))
+		for f, field := range fields {
+			if values[f], err = secretString(secretObjectInter, i, field, optional[field]); err != nil {
+				return fmt.Errorf("Secrets file %s: %v", secretsFile, err)
 			}
 		}
+
+		switch secretType {
+		case "text":
+			b.AddStringSecret(values[0], values[1])
+		case "ssh":
+			b.AddSSHWithPrivate(values[0], values[1], values[2], values[3])
+		case "userpass":
+			b.AddUserPassword(values[0], values[1], values[2])
+		}
 	}
 
 	return
 }
 
-func runBuild(scriptFileName string, funcCalls []string, secretsFile string) (done chan goja.Value, abort chan bool, startErr error) {
-	abort = make(chan bool)
-	done = make(chan goja.Value)
+//textSecretFromFile return the text of a text secret in a secrets file
+func textSecretFromFile(secretsFile, secretID string) (string, error) {
+	secrets, err := readSecretsFile(secretsFile)
+	if err != nil {
+		return "", err
+	}
+	for _, secret := range secrets {
+		if id, _ := secret["id"].(string); id != secretID {
+			continue
+		}
+		if secretType, _ := secret["type"].(string); secretType != infra.SecretTypeText {
+			return "", fmt.Errorf("Secret %s is not a Text secret", secretID)
+		}
+		text, _ := secret["text"].(string)
+		return text, nil
+	}
+	return "", infra.ErrSecretNotFound
+}
+
+//resolveScriptFileName use Banaifile.js if the default Banaifile does not exist
+func resolveScriptFileName(scriptFileName string) string {
+	if scriptFileName == defaultScriptFileName {
+		_, err := os.Stat(scriptFileName)
+		if os.IsNotExist(err) {
+			scriptFileName = defaultScriptFileName + ".js"
+		}
+	}
+	return scriptFileName
+}
+
+//loadProgram compile the script, register all banai objects and run the top level code of the script.
+//Panics if the script cannot be loaded
+func loadProgram(b *infra.Banai, scriptFileName string) error {
+	program, err := goja.Compile(scriptFileName, loadScript(scriptFileName), false)
+	if err != nil {
+
+		panic(fmt.Sprintln("Failed to compile script ", scriptFileName, err))
+	}
 
+	shell.RegisterJSObjects(b)
+	archive.RegisterJSObjects(b)
+	fs.RegisterJSObjects(b)
+	hashImpl.RegisterJSObjects(b)
+	httpclient.RegisterJSObjects(b)
+	secret.RegisterJSObjects(b)
+	targets.RegisterJSObjects(b)
+	cache.RegisterJSObjects(b)
+	stash.RegisterJSObjects(b)
+
+	_, err = b.Jse.RunProgram(program)
+
+	if err != nil {
+		return fmt.Errorf("Failed to run program %s", err)
+	}
+	return nil
+}
+
+//declaredSchedules the scheduled runs declared in a Banaifile by the schedule() function
+func declaredSchedules(scriptFileName string) (schedules []infra.ScheduledRun, err error) {
 	var b = infra.NewBanai()
-	var runReturnedValue goja.Value
-	b.PanicOnError(loadSecrets(secretsFile, b))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		b.Close()
+	}()
+
+	if err = loadProgram(b, scriptFileName); err != nil {
+		return nil, err
+	}
+	return b.Schedules(), nil
+}
+
+//buildOptions what to run and how to run it
+type buildOptions struct {
+	ScriptFileName string
+	Targets        []string
+	SecretsFile    string
+	Jobs           int               //Number of targets to run in parallel
+	Worker         bool              //Run the targets as a worker of a parallel run, without their dependencies
+	Out            io.Writer         //Where the log and output of the build are written. Default is stdout
+	Env            []string          //Environment variables, as KEY=VALUE, added to the build
+	Params         map[string]string //Parameters given by -p name=value. Available to the script as the params object
+	DryRun         bool              //Log the calls with side effects instead of running them
+	CacheDir       string            //Folder of the cache. Empty for the default
+	CacheSizeMB    int64             //Size limit of the cache in MB. 0 for the default
+	KeepStash      bool              //Keep the stashes after the build ends
+}
+
+//buildResult how a build ended
+type buildResult struct {
+	Value goja.Value //The value returned by the last target that ran
+	Err   error      //Why the build failed. nil if it succeeded
+}
+
+//abortOnSignal abort the build on SIGINT or SIGTERM, so the processes the script started are stopped before banai
+//exits. A second signal is not caught, and ends banai at once
+func abortOnSignal(abort chan<- bool) {
+	var signals = make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		fmt.Println("Received", sig, "aborting the build")
+		abort <- true
+	}()
+}
+
+func runBuild(opt buildOptions) (done chan buildResult, abort chan bool, startErr error) {
+	//Sending an abort never blocks, even after the build ended
+	abort = make(chan bool, 1)
+	done = make(chan buildResult)
+
+	var b *infra.Banai
+	if opt.Worker {
+		b = infra.NewWorkerBanai()
+	} else {
+		b = infra.NewBanai()
+	}
+	if opt.Out == nil {
+		opt.Out = os.Stdout
+	}
+	b.SetOutput(opt.Out)
+	b.Env = opt.Env
+	b.DryRun = opt.DryRun
+	b.KeepStash = opt.KeepStash
+	if opt.CacheDir != "" {
+		b.CacheDir = opt.CacheDir
+	}
+	if opt.CacheSizeMB > 0 {
+		b.CacheSizeLimit = opt.CacheSizeMB * 1024 * 1024
+	}
+	var result buildResult
+	if startErr = loadSecrets(opt.SecretsFile, b); startErr != nil {
+		b.Close()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	//--------- go routin for reporting log out an
 	go func() {
 		defer func() {
 			if err := recover(); err != nil {
 				b.Logger.Error(err)
 				b.Logger.Error("Script execution exit with error !!!!!")
+				if result.Err == nil {
+					result.Err = fmt.Errorf("%v", err)
+				}
+			}
+			cancel()
+			//Targets of a parallel run log their own skipped calls
+			if opt.DryRun && opt.Jobs <= 1 {
+				b.Logger.Info("Dry run ended, skipped ", len(b.DryRunCalls()), " calls with side effects")
 			}
 			b.Close()
-			done <- runReturnedValue
+			done <- result
 
 		}()
 
 		go func() {
-			<-abort
+			select {
+			case <-abort:
+			case <-ctx.Done():
+				//The build ended
+				return
+			}
 			b.Jse.Interrupt("Abort execution")
+			b.Cleanup()
+			cancel()
 		}()
-		if scriptFileName == defaultScriptFileName {
-			_, err := os.Stat(scriptFileName)
-			if os.IsNotExist(err) {
-				scriptFileName = defaultScriptFileName + ".js"
-			}
-		}
-		program, err := goja.Compile(scriptFileName, loadScript(scriptFileName), false)
+		scriptFileName := resolveScriptFileName(opt.ScriptFileName)
+		workDir, err := os.Getwd()
 		if err != nil {
-
-			panic(fmt.Sprintln("Failed to compile script ", scriptFileName, err))
+			panic(err)
+		}
+		b.Jse.GlobalObject().Set(paramsObjectName, cliParamsObject(opt.Params))
+		if result.Err = loadProgram(b, scriptFileName); result.Err != nil {
+			return
 		}
 
-		shell.RegisterJSObjects(b)
-		archive.RegisterJSObjects(b)
-		fs.RegisterJSObjects(b)
-		hashImpl.RegisterJSObjects(b)
-		httpclient.RegisterJSObjects(b)
-		secret.RegisterJSObjects(b)
+		var targetNames = []string{mainFuncName}
+		var targetArgs = make(map[string][]string)
 
-		_, err = b.Jse.RunProgram(program)
+		if len(opt.Targets) > 0 {
+			targetNames = make([]string, 0, len(opt.Targets))
+			for _, s := range opt.Targets {
+				name, args := parseTargetCall(s)
+				targetNames = append(targetNames, name)
+				targetArgs[name] = args
+			}
+		}
 
+		var targetsToRun []*infra.Target
+		if opt.Worker {
+			for _, name := range targetNames {
+				t, ok := b.GetTarget(name)
+				if !ok {
+					b.Logger.Panic(fmt.Errorf("Target %s not found", name))
+				}
+				targetsToRun = append(targetsToRun, t)
+			}
+		} else {
+			targetsToRun, err = b.ResolveTargets(targetNames)
+			if err != nil {
+				b.Logger.Error(err)
+				result.Err = err
+				return
+			}
+		}
+
+		calls, params, err := resolveParams(targetsToRun, targetArgs, opt.Params)
 		if err != nil {
-			runReturnedValue = b.Jse.ToValue(fmt.Errorf("Failed to run program %s", err))
+			b.Logger.Error(err)
+			result.Err = err
 			return
 		}
-
-		var funcNames = []string{"main"}
-
-		if len(funcCalls) > 0 {
-			funcNames = funcCalls
+		b.Jse.GlobalObject().Set(paramsObjectName, params)
+
+		if opt.Jobs > 1 {
+			err = runTargetsInParallel(ctx, parallelRun{
+				ScriptFileName: scriptFileName,
+				SecretsFile:    opt.SecretsFile,
+				WorkDir:        workDir,
+				Jobs:           opt.Jobs,
+				Out:            opt.Out,
+				Env:            opt.Env,
+				Params:         opt.Params,
+				Args:           targetArgs,
+				DryRun:         opt.DryRun,
+				CacheDir:       opt.CacheDir,
+				CacheSizeMB:    opt.CacheSizeMB,
+			}, targetsToRun)
+			if err != nil {
+				b.Logger.Error(err)
+				result.Err = err
+			}
+			return
 		}
 
-		for _, fn := range funcNames {
-			_, ok := goja.AssertFunction(b.Jse.Get(fn))
-			if !ok {
-				b.Logger.Panic(fmt.Errorf("function %s not found", fn))
+		for _, call := range calls {
+			if call.Target.Fn == nil {
+				continue
+			}
+			upToDate, inputsHash, err := targets.UpToDate(call.Target, call.Args)
+			if err != nil {
+				b.Logger.Error(err)
+				result.Err = err
+				break
 			}
-			_, err = b.Jse.RunString(fmt.Sprintf("%s()", fn))
-			if jserr, ok := err.(*goja.Exception); ok {
-				b.Logger.Error("Failure at execution ", jserr)
-				runReturnedValue = b.Jse.ToValue(jserr)
+			if upToDate {
+				b.Logger.Info("Target ", call.Target.Name, " is up to date")
+				continue
+			}
+			b.Logger.Info("Running target ", call.Target.Name)
+			result.Value, err = callTarget(b, call)
+			if err != nil {
+				b.Logger.Error("Failure at execution of target ", call.Target.Name, " ", err)
+				result.Err = err
 				break
 			}
+			if err = targets.TargetDone(call.Target, inputsHash); err != nil {
+				b.Logger.Warn("Failed to save the state of target ", call.Target.Name, " ", err)
+			}
 
 		}
 
@@ -161,31 +410,81 @@ func runBuild(scriptFileName string, funcCalls []string, secretsFile string) (do
 
 func main() {
 
-	var scriptFileName = defaultScriptFileName
-	var funcCalls []string
+	if len(os.Args) > 1 && os.Args[1] == historyCommand {
+		if err := runHistoryCommand(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var opt = buildOptions{Params: make(paramsFlag)}
 	var isAgent bool
-	var secretsFile string
+	var agentOpt agentOptions
+	var list bool
 
-	flag.StringVar(&scriptFileName, "f", defaultScriptFileName, "Set script to run. Default is Banaifile")
-	flag.StringVar(&scriptFileName, "file", defaultScriptFileName, "Set script to run. Default is Banaifile")
+	flag.StringVar(&opt.ScriptFileName, "f", defaultScriptFileName, "Set script to run. Default is Banaifile")
+	flag.StringVar(&opt.ScriptFileName, "file", defaultScriptFileName, "Set script to run. Default is Banaifile")
 	flag.BoolVar(&isAgent, "agent", false, "true if banai is run as agent")
-	flag.StringVar(&secretsFile, "s", "", "A secrets file. See examples/secret-file.json")
-	flag.StringVar(&secretsFile, "secrets", "", "A secrets file. See examples/secret-file.json")
+	flag.StringVar(&agentOpt.Addr, "agent-addr", defaultAgentAddr, "Address the agent API listens on")
+	flag.StringVar(&agentOpt.Dir, "agent-dir", defaultAgentDir, "Folder where the agent creates the working folder of every job")
+	flag.StringVar(&agentOpt.ScheduleFile, "agent-schedule", "", "A schedule config file of builds the agent runs on a cron schedule")
+	flag.StringVar(&agentOpt.WebhooksFile, "agent-webhooks", "", "A webhooks config file of builds the agent runs on git push events")
+	flag.StringVar(&agentOpt.TokenSecretID, "agent-token", "", "Id of a text secret, in the -s secrets file, that API requests must send as a bearer token")
+	flag.StringVar(&agentOpt.SecretsDir, "agent-secrets-dir", "", "Folder of the secrets files that jobs can name. Jobs cannot name secrets files if not set")
+	flag.DurationVar(&agentOpt.Retention, "agent-retention", defaultAgentRetention, "How long ended jobs and their folders are kept. 0 keeps them until the agent stops")
+	flag.StringVar(&opt.SecretsFile, "s", "", "A secrets file. See examples/secret-file.json")
+	flag.StringVar(&opt.SecretsFile, "secrets", "", "A secrets file. See examples/secret-file.json")
+	flag.BoolVar(&list, "l", false, "List the targets and functions of the script, with their description, parameters and dependencies")
+	flag.BoolVar(&list, "list", false, "List the targets and functions of the script, with their description, parameters and dependencies")
+	flag.Var(paramsFlag(opt.Params), "p", "A parameter of the build as name=value. Can be repeated")
+	flag.BoolVar(&opt.DryRun, "dry-run", false, "Log what commands with side effects would do instead of running them")
+	flag.StringVar(&opt.CacheDir, "cache-dir", "", "Folder where cache() keeps its entries. Default is $BANAI_CACHE_DIR or banai in the user cache folder")
+	flag.Int64Var(&opt.CacheSizeMB, "cache-size", 0, "Size limit of the cache in MB. Default is 10240")
+	flag.IntVar(&opt.Jobs, "j", 1, "Number of independent targets to run in parallel")
+	flag.BoolVar(&opt.Worker, workerFlag, false, "Internal. Run the named targets, without their dependencies, for a parallel banai run")
 	flag.Parse()
 
-	funcCalls = flag.Args()
+	opt.Targets = flag.Args()
+	if opt.CacheDir != "" {
+		//Agent jobs and workers may run in other folders
+		if abs, err := filepath.Abs(opt.CacheDir); err == nil {
+			opt.CacheDir = abs
+		}
+	}
 
-	//----------- converting
-	if !isAgent {
-		doneCH, _, _ := runBuild(scriptFileName, funcCalls, secretsFile)
+	if isAgent {
+		if err := runAgent(agentOpt, opt); err != nil {
+			fmt.Println("Agent stopped:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-		exitValue := <-doneCH
-		if exitValue != nil {
-			fmt.Println("Exit running Banaifile", scriptFileName, " Last result was ", exitValue)
-		} else {
-			fmt.Println("Exit running Banaifile", scriptFileName)
+	if list {
+		if err := listTargets(opt.ScriptFileName, os.Stdout); err != nil {
+			fmt.Println("Failed to list Banaifile", opt.ScriptFileName, err)
+			os.Exit(1)
 		}
+		return
+	}
 
+	//----------- converting
+	doneCH, abortCH, err := runBuild(opt)
+	if err != nil {
+		fmt.Println("Failed to start Banaifile", opt.ScriptFileName, err)
+		os.Exit(1)
+	}
+	abortOnSignal(abortCH)
+
+	result := <-doneCH
+	if result.Err != nil {
+		fmt.Println("Exit running Banaifile", opt.ScriptFileName, " Last result was ", result.Err)
+		os.Exit(1)
+	} else if result.Value != nil && !goja.IsUndefined(result.Value) {
+		fmt.Println("Exit running Banaifile", opt.ScriptFileName, " Last result was ", result.Value)
+	} else {
+		fmt.Println("Exit running Banaifile", opt.ScriptFileName)
 	}
 
 }
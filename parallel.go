@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sagiforbes/banai/infra"
+)
+
+const workerFlag = "worker"
+
+//parallelRun how to start worker processes of a parallel run
+type parallelRun struct {
+	ScriptFileName string
+	SecretsFile    string
+	WorkDir        string
+	Jobs           int
+	Out            io.Writer           //Where the prefixed output of the workers is written
+	Env            []string            //Environment variables, as KEY=VALUE, added to the workers
+	Params         map[string]string   //The -p parameters, passed to the workers
+	Args           map[string][]string //Arguments given to targets on the command line, by target name
+	DryRun         bool
+	CacheDir       string
+	CacheSizeMB    int64
+}
+
+//prefixWriter writes the output of all workers to out, line by line, each line prefixed with the target name
+type prefixWriter struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+func (w *prefixWriter) copyLines(prefix string, in io.Reader, wg *sync.WaitGroup) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		w.mutex.Lock()
+		fmt.Fprintf(w.out, "[%s] %s\n", prefix, scanner.Text())
+		w.mutex.Unlock()
+	}
+}
+
+//workerStopGrace how long a worker that was asked to stop has to clean up before it is killed
+const workerStopGrace = 30 * time.Second
+
+//stopWorker ask the worker to stop with SIGTERM, so it stops the processes its script started, and kill it if it
+//did not end after workerStopGrace. Where signals are not supported it is killed at once
+func stopWorker(cmd *exec.Cmd, ended <-chan struct{}) {
+	if cmd.Process.Signal(syscall.SIGTERM) != nil {
+		cmd.Process.Kill()
+		return
+	}
+	select {
+	case <-ended:
+	case <-time.After(workerStopGrace):
+		cmd.Process.Kill()
+	}
+}
+
+//runWorker runs a single target in a separate banai process, so it gets its own javascript runtime
+func runWorker(ctx context.Context, run parallelRun, t *infra.Target, out *prefixWriter) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{"-f", run.ScriptFileName, "-" + workerFlag}
+	if run.SecretsFile != "" {
+		args = append(args, "-s", run.SecretsFile)
+	}
+	if run.DryRun {
+		args = append(args, "-dry-run")
+	}
+	if run.CacheDir != "" {
+		args = append(args, "-cache-dir", run.CacheDir)
+	}
+	if run.CacheSizeMB > 0 {
+		args = append(args, "-cache-size", strconv.FormatInt(run.CacheSizeMB, 10))
+	}
+	for _, p := range paramsArgs(run.Params) {
+		args = append(args, "-p", p)
+	}
+	args = append(args, formatTargetCall(t.Name, run.Args[t.Name]))
+
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = run.WorkDir
+	cmd.Env = append(os.Environ(), run.Env...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	var ended = make(chan struct{})
+	defer close(ended)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopWorker(cmd, ended)
+		case <-ended:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go out.copyLines(t.Name, stdout, &wg)
+	go out.copyLines(t.Name, stderr, &wg)
+	wg.Wait()
+
+	if err = cmd.Wait(); err != nil {
+		return fmt.Errorf("Target %s failed: %s", t.Name, err)
+	}
+	return nil
+}
+
+//runTargetsInParallel runs the targets, each one after all its dependencies ended, and up to run.Jobs targets at once.
+//targetsToRun must hold every dependency of its targets. No new target starts after a target fails
+func runTargetsInParallel(ctx context.Context, run parallelRun, targetsToRun []*infra.Target) error {
+	type result struct {
+		name string
+		err  error
+	}
+	var out = &prefixWriter{out: run.Out}
+	var results = make(chan result)
+	var pending = append([]*infra.Target{}, targetsToRun...)
+	var completed = make(map[string]bool)
+	var running = 0
+	var firstErr error
+
+	isReady := func(t *infra.Target) bool {
+		for _, dep := range t.Deps {
+			if !completed[dep] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(pending) > 0 || running > 0 {
+		if firstErr == nil {
+			for i := 0; i < len(pending) && running < run.Jobs; {
+				t := pending[i]
+				if !isReady(t) {
+					i++
+					continue
+				}
+				pending = append(pending[:i], pending[i+1:]...)
+				if t.Fn == nil {
+					completed[t.Name] = true
+					i = 0
+					continue
+				}
+				running++
+				go func(t *infra.Target) {
+					results <- result{name: t.Name, err: runWorker(ctx, run, t, out)}
+				}(t)
+			}
+		}
+		if running == 0 {
+			if firstErr == nil && len(pending) > 0 {
+				firstErr = fmt.Errorf("Cannot run target %s, its dependencies did not run", pending[0].Name)
+			}
+			break
+		}
+
+		r := <-results
+		running--
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		completed[r.name] = true
+	}
+
+	return firstErr
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/sagiforbes/banai/infra"
+)
+
+const paramsObjectName = "params"
+
+//paramsFlag collects the -p name=value flags of the command line
+type paramsFlag map[string]string
+
+func (p paramsFlag) String() string {
+	return strings.Join(paramsArgs(p), " ")
+}
+
+func (p paramsFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("Parameter must be name=value, got %s", value)
+	}
+	p[value[:i]] = value[i+1:]
+	return nil
+}
+
+//paramsArgs the parameters as name=value, sorted by name
+func paramsArgs(params map[string]string) []string {
+	var ret = make([]string, 0, len(params))
+	for k, v := range params {
+		ret = append(ret, k+"="+v)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+//parseTargetCall split a target given on the command line as target:arg1,arg2 to its name and arguments
+func parseTargetCall(s string) (name string, args []string) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return s, nil
+	}
+	name = s[:i]
+	if s[i+1:] != "" {
+		args = strings.Split(s[i+1:], ",")
+	}
+	return
+}
+
+//formatTargetCall the reverse of parseTargetCall
+func formatTargetCall(name string, args []string) string {
+	if len(args) == 0 {
+		return name
+	}
+	return name + ":" + strings.Join(args, ",")
+}
+
+//cliParamsObject the params object before the parameters of the targets are resolved. Holds the -p values as is
+func cliParamsObject(cliParams map[string]string) map[string]interface{} {
+	var ret = make(map[string]interface{})
+	for k, v := range cliParams {
+		ret[k] = v
+	}
+	return ret
+}
+
+//targetCall a target to run and the arguments its function is called with
+type targetCall struct {
+	Target *infra.Target
+	Args   []interface{}
+}
+
+//resolveParams check the parameters of every target against the parameters it declares, and return the
+//arguments to call each target with. params holds the -p values merged with the values of all declared parameters
+func resolveParams(targetsToRun []*infra.Target, targetArgs map[string][]string, cliParams map[string]string) (calls []targetCall, params map[string]interface{}, err error) {
+	params = cliParamsObject(cliParams)
+	for _, t := range targetsToRun {
+		values, args, err := t.ParamValues(targetArgs[t.Name], cliParams)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range values {
+			params[k] = v
+		}
+		calls = append(calls, targetCall{Target: t, Args: args})
+	}
+	return calls, params, nil
+}
+
+//callTarget call the function of a target with its arguments
+func callTarget(b *infra.Banai, call targetCall) (goja.Value, error) {
+	var args = make([]goja.Value, 0, len(call.Args))
+	for _, a := range call.Args {
+		args = append(args, b.Jse.ToValue(a))
+	}
+	return call.Target.Fn(goja.Undefined(), args...)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTargetCall(t *testing.T) {
+	var tests = []struct {
+		call string
+		name string
+		args []string
+	}{
+		{call: "build", name: "build"},
+		{call: "build:", name: "build"},
+		{call: "deploy:prod", name: "deploy", args: []string{"prod"}},
+		{call: "deploy:prod,eu", name: "deploy", args: []string{"prod", "eu"}},
+		{call: "deploy:prod,", name: "deploy", args: []string{"prod", ""}},
+		{call: "deploy:url=http://host:8080", name: "deploy", args: []string{"url=http://host:8080"}},
+		{call: ":prod", name: "", args: []string{"prod"}},
+	}
+	for _, tt := range tests {
+		name, args := parseTargetCall(tt.call)
+		if name != tt.name || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("parseTargetCall(%q) = %q, %q, want %q, %q", tt.call, name, args, tt.name, tt.args)
+		}
+	}
+}
+
+func TestFormatTargetCall(t *testing.T) {
+	var tests = []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "build", want: "build"},
+		{name: "build", args: []string{}, want: "build"},
+		{name: "deploy", args: []string{"prod"}, want: "deploy:prod"},
+		{name: "deploy", args: []string{"prod", "eu"}, want: "deploy:prod,eu"},
+	}
+	for _, tt := range tests {
+		got := formatTargetCall(tt.name, tt.args)
+		if got != tt.want {
+			t.Errorf("formatTargetCall(%q, %q) = %q, want %q", tt.name, tt.args, got, tt.want)
+			continue
+		}
+		if name, args := parseTargetCall(got); name != tt.name || len(args) != len(tt.args) {
+			t.Errorf("parseTargetCall(%q) = %q, %q, want %q, %q", got, name, args, tt.name, tt.args)
+		}
+	}
+}
+
+func TestParamsFlag(t *testing.T) {
+	var tests = []struct {
+		value   string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{value: "env=prod", name: "env", want: "prod"},
+		{value: "env=", name: "env", want: ""},
+		{value: "url=http://host/?a=b", name: "url", want: "http://host/?a=b"},
+		{value: "env", wantErr: true},
+		{value: "=prod", wantErr: true},
+	}
+	for _, tt := range tests {
+		p := paramsFlag{}
+		err := p.Set(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q) did not fail", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q) failed: %s", tt.value, err)
+			continue
+		}
+		if got, ok := p[tt.name]; !ok || got != tt.want {
+			t.Errorf("Set(%q) gave %q = %q, want %q", tt.value, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParamsArgsSorted(t *testing.T) {
+	got := paramsArgs(map[string]string{"b": "2", "a": "1", "c": "x=y"})
+	want := []string{"a=1", "b=2", "c=x=y"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paramsArgs = %q, want %q", got, want)
+	}
+}
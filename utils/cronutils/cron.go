@@ -0,0 +1,191 @@
+package cronutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Schedule a parsed cron expression. Use Next to find when it fires
+type Schedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//maxSearchYears how far in the future Next looks for a matching time
+const maxSearchYears = 5
+
+//Parse a standard 5 fields cron expression: minute hour day-of-month month day-of-week.
+//Fields may hold *, numbers, ranges (1-5), steps (*/15, 1-30/2), lists (1,15) and month and day names.
+//The macros @yearly, @monthly, @weekly, @daily and @hourly are supported too
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression %q, expected 5 fields", expr)
+	}
+
+	var s = &Schedule{}
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 //7 is sunday as well as 0
+	}
+	s.domStar = parts[2] == "*" || parts[2] == "?"
+	s.dowStar = parts[4] == "*" || parts[4] == "?"
+	return s, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s value %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[idx+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("Invalid %s step in %q", f.name, item)
+			}
+			item = item[:idx]
+		}
+
+		var from, to int
+		switch {
+		case item == "*" || item == "?":
+			from, to = f.min, f.max
+		case strings.Contains(item, "-"):
+			idx := strings.Index(item, "-")
+			var err error
+			if from, err = parseValue(item[:idx], f); err != nil {
+				return 0, err
+			}
+			if to, err = parseValue(item[idx+1:], f); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("Invalid %s range %q", f.name, item)
+			}
+		default:
+			var err error
+			if from, err = parseValue(item, f); err != nil {
+				return 0, err
+			}
+			to = from
+			if step > 1 {
+				to = f.max
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, t.Day())
+	dowMatch := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+//Next the first time after t that the schedule fires. Returns the zero time if there is no such time
+//in the next few years (e.g. 30 of February)
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
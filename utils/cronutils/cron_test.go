@@ -0,0 +1,84 @@
+package cronutils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	var tests = []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 * ",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@every",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) did not fail", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	//A Wednesday
+	var from = time.Date(2021, time.March, 3, 10, 17, 30, 0, time.UTC)
+	var tests = []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2021, time.March, 3, 10, 18, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2021, time.March, 3, 10, 30, 0, 0, time.UTC)},
+		{expr: "5 * * * *", want: time.Date(2021, time.March, 3, 11, 5, 0, 0, time.UTC)},
+		{expr: "0 9 * * *", want: time.Date(2021, time.March, 4, 9, 0, 0, 0, time.UTC)},
+		{expr: "30 2 1 * *", want: time.Date(2021, time.April, 1, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 0 * * mon", want: time.Date(2021, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 0", want: time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * mon-fri", want: time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 * jun *", want: time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)},
+		{expr: "0 8-10/2 * * *", want: time.Date(2021, time.March, 4, 8, 0, 0, 0, time.UTC)},
+		{expr: "0,45 * * * *", want: time.Date(2021, time.March, 3, 10, 45, 0, 0, time.UTC)},
+		//With both days set, either of them matches
+		{expr: "0 0 15 * fri", want: time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@daily", want: time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "@hourly", want: time.Date(2021, time.March, 3, 11, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", want: time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", want: time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "@yearly", want: time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		//Never fires
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next of %q = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestNextIsAfter(t *testing.T) {
+	s, err := Parse("30 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var at = time.Date(2021, time.March, 3, 10, 30, 0, 0, time.UTC)
+	if got, want := s.Next(at), at.AddDate(0, 0, 1); !got.Equal(want) {
+		t.Errorf("Next(%s) = %s, want %s", at, got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package fsutils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//CopyTree copies the file or folder source to destination, keeping file modes and symbolic links.
+//destination is created, or overwritten if it is a file. Returns the number of bytes copied
+func CopyTree(source, destination string) (int64, error) {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return 0, err
+		}
+		os.Remove(destination)
+		return 0, os.Symlink(link, destination)
+
+	case info.IsDir():
+		if err = os.MkdirAll(destination, info.Mode().Perm()|0700); err != nil {
+			return 0, err
+		}
+		f, err := os.Open(source)
+		if err != nil {
+			return 0, err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		var total int64
+		for _, name := range names {
+			n, err := CopyTree(filepath.Join(source, name), filepath.Join(destination, name))
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+		return total, nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/sagiforbes/banai/utils/shellutils"
 )
@@ -60,7 +61,62 @@ func ZipFolder(zipFileName, sourcePath string) ([]string, error) {
 	return filesToZip, nil
 }
 
-//Unzip zip file to target folder. If no target folder is given, will unzip to current folder
+//ZipFolderTo write a zip of all the files in folder to w. Files are named in the zip relative to folder
+func ZipFolderTo(w io.Writer, folder string) error {
+	zwriter := zip.NewWriter(w)
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		zf, err := zwriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		srcFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+		_, err = io.Copy(zf, srcFile)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zwriter.Close()
+}
+
+//unzipFile write zippedFile to destFilePath, replacing the file that is there
+func unzipFile(zippedFile *zip.File, destFilePath string) error {
+	dstFile, err := os.OpenFile(destFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("unzip Failed to create destination file %s, %s", destFilePath, err)
+	}
+	defer dstFile.Close()
+
+	zfc, err := zippedFile.Open()
+	if err != nil {
+		return fmt.Errorf("unzip Failed to open zipped file %s, %s", zippedFile.Name, err)
+	}
+	defer zfc.Close()
+	if _, err = io.Copy(dstFile, zfc); err != nil {
+		return fmt.Errorf("unzip Failed to extract %s, %s", zippedFile.Name, err)
+	}
+	return dstFile.Close()
+}
+
+//Unzip zip file to target folder. If no target folder is given, will unzip to current folder. Files whose path
+//leads out of the target folder are refused
 func Unzip(zipFileName, targetPath string) ([]string, error) {
 	if targetPath == "" {
 		targetPath = "."
@@ -73,11 +129,18 @@ func Unzip(zipFileName, targetPath string) ([]string, error) {
 	defer zf.Close()
 	var destFilePath string
 	var destFolder string
-	var dstFile *os.File
-	var zfc io.ReadCloser
 	var extractedFiles = make([]string, 0)
 	for _, zippedFile := range zf.File {
 		destFilePath = filepath.Join(targetPath, zippedFile.Name)
+		if rel, err := filepath.Rel(targetPath, destFilePath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("unzip Refused %s, its path leads out of %s", zippedFile.Name, targetPath)
+		}
+		if zippedFile.FileInfo().IsDir() {
+			if err = os.MkdirAll(destFilePath, 0755); err != nil {
+				return nil, fmt.Errorf("unzip Failed to create destination folder %s, %s", destFilePath, err)
+			}
+			continue
+		}
 		extractedFiles = append(extractedFiles, destFilePath)
 		destFolder = filepath.Dir(destFilePath)
 		err = os.MkdirAll(destFolder, 0755)
@@ -85,18 +148,9 @@ func Unzip(zipFileName, targetPath string) ([]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("unzip Failed to create destination folder %s, %s", destFolder, err)
 		}
-		dstFile, err = os.OpenFile(destFilePath, os.O_CREATE|os.O_RDWR, 0644)
-		if err != nil {
-			return nil, fmt.Errorf("unzip Failed to create destination file %s, %s", destFilePath, err)
-		}
-
-		zfc, err = zippedFile.Open()
-		if err != nil {
-			return nil, fmt.Errorf("unzip Failed to open zipped file %s, %s", zippedFile.Name, err)
+		if err = unzipFile(zippedFile, destFilePath); err != nil {
+			return nil, err
 		}
-		io.Copy(dstFile, zfc)
-		zfc.Close()
-		dstFile.Close()
 	}
 
 	return extractedFiles, nil
@@ -127,7 +181,7 @@ func copyDir(source, destination string) error {
 		}
 	}
 
-	res, e := shellutils.RunShellCommand(fmt.Sprintf("cp -r %s %s", srca, desa))
+	res, e := shellutils.RunCommand("cp", []string{"-r", srca, desa})
 	if e != nil {
 		return e
 	}
@@ -152,7 +206,7 @@ func copyFile(source, destination string) error {
 	if srca == desa {
 		return nil //nothing todo no need to copy the file to itself
 	}
-	res, e := shellutils.RunShellCommand(fmt.Sprintf("cp %s %s", srca, desa))
+	res, e := shellutils.RunCommand("cp", []string{srca, desa})
 	if e != nil {
 		return e
 	}
@@ -176,5 +230,5 @@ func CopyfsItem(source, destination string) error {
 	if sourceStat.Mode().IsRegular() {
 		return copyFile(source, destination)
 	}
-	return fmt.Errorf("Cannot copy ", source)
+	return fmt.Errorf("Cannot copy %s", source)
 }
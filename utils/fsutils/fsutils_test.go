@@ -0,0 +1,113 @@
+package fsutils
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//writeZip create a zip file in dir with the given entries, name to content. A name ending with / is a folder
+func writeZip(t *testing.T, dir string, entries ...[2]string) string {
+	t.Helper()
+	zipFileName := filepath.Join(dir, "test.zip")
+	f, err := os.Create(zipFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return zipFileName
+}
+
+func TestUnzip(t *testing.T) {
+	dir := t.TempDir()
+	zipFileName := writeZip(t, dir, [2]string{"a.txt", "a"}, [2]string{"sub/", ""}, [2]string{"sub/b.txt", "b"},
+		[2]string{"deep/er/c.txt", "c"})
+	target := filepath.Join(dir, "out")
+	files, err := Unzip(zipFileName, target)
+	if err != nil {
+		t.Fatalf("Unzip failed: %s", err)
+	}
+	if len(files) != 3 {
+		t.Errorf("Unzip extracted %q, want 3 files", files)
+	}
+	for name, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "deep/er/c.txt": "c"} {
+		got, err := ioutil.ReadFile(filepath.Join(target, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s has %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestUnzipTruncates(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(target, "a.txt"), []byte("a much longer old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unzip(writeZip(t, dir, [2]string{"a.txt", "new"}), target); err != nil {
+		t.Fatalf("Unzip failed: %s", err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(target, "a.txt")); string(got) != "new" {
+		t.Errorf("a.txt has %q, want %q", got, "new")
+	}
+}
+
+func TestUnzipRefusesPathsOutOfTarget(t *testing.T) {
+	var tests = []string{
+		"../evil.txt",
+		"../../evil.txt",
+		"sub/../../evil.txt",
+		"./../evil.txt",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "a", "out")
+			if _, err := Unzip(writeZip(t, dir, [2]string{name, "evil"}), target); err == nil {
+				t.Errorf("Unzip accepted %s", name)
+			}
+			found, _ := filepath.Glob(filepath.Join(dir, "*", "evil.txt"))
+			found2, _ := filepath.Glob(filepath.Join(dir, "evil.txt"))
+			if len(found)+len(found2) > 0 {
+				t.Errorf("Unzip wrote %q", append(found, found2...))
+			}
+		})
+	}
+}
+
+func TestUnzipKeepsAbsolutePathsInTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out")
+	files, err := Unzip(writeZip(t, dir, [2]string{"/tmp/evil.txt", "evil"}), target)
+	if err != nil {
+		t.Fatalf("Unzip failed: %s", err)
+	}
+	want := filepath.Join(target, "tmp", "evil.txt")
+	if len(files) != 1 || files[0] != want {
+		t.Errorf("Unzip extracted %q, want %q", files, want)
+	}
+}
+
+func TestUnzipMissingFile(t *testing.T) {
+	if _, err := Unzip(filepath.Join(t.TempDir(), "missing.zip"), t.TempDir()); err == nil {
+		t.Errorf("Unzip of a missing file did not fail")
+	}
+}
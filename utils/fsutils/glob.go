@@ -0,0 +1,114 @@
+package fsutils
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//globToRegexp convert a glob pattern, that may have ** to match any number of folders, to a regular expression
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+//globRoot the folder to start searching from, the part of the pattern before the first wildcard
+func globRoot(pattern string) string {
+	i := strings.IndexAny(pattern, "*?[")
+	if i < 0 {
+		return pattern
+	}
+	return filepath.Dir(pattern[:i] + "x")
+}
+
+//Glob return the files that match any of the patterns, sorted and without duplicates. Patterns are as in
+//filepath.Match, plus ** that matches any number of folders. A pattern that matches a folder matches all the files in it
+func Glob(patterns ...string) ([]string, error) {
+	var found = make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(filepath.Clean(pattern))
+		re, err := globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		root := globRoot(pattern)
+		info, err := os.Stat(root)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if root == pattern {
+			if info.IsDir() {
+				for _, f := range listFilesInFolder(root) {
+					found[f] = true
+				}
+			} else {
+				found[root] = true
+			}
+			continue
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != root && re.MatchString(filepath.ToSlash(path)) {
+					for _, f := range listFilesInFolder(path) {
+						found[f] = true
+					}
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if re.MatchString(filepath.ToSlash(path)) {
+				found[path] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var files = make([]string, 0, len(found))
+	for f := range found {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,116 @@
+package fsutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "*.go", path: "main.go", want: true},
+		{pattern: "*.go", path: "cmd/main.go", want: false},
+		{pattern: "src/*.go", path: "src/main.go", want: true},
+		{pattern: "src/*.go", path: "src/pkg/main.go", want: false},
+		{pattern: "src/**/*.go", path: "src/main.go", want: true},
+		{pattern: "src/**/*.go", path: "src/pkg/sub/main.go", want: true},
+		{pattern: "src/**/*.go", path: "srcx/main.go", want: false},
+		{pattern: "**/*.go", path: "main.go", want: true},
+		{pattern: "**/*.go", path: "a/b/main.go", want: true},
+		{pattern: "src/**", path: "src/a/b/c.txt", want: true},
+		{pattern: "src/**", path: "other/c.txt", want: false},
+		{pattern: "file?.txt", path: "file1.txt", want: true},
+		{pattern: "file?.txt", path: "file10.txt", want: false},
+		{pattern: "a?b", path: "a/b", want: false},
+		{pattern: "file[0-9].txt", path: "file7.txt", want: true},
+		{pattern: "file[0-9].txt", path: "filex.txt", want: false},
+		{pattern: "file[!0-9].txt", path: "filex.txt", want: true},
+		{pattern: "file[!0-9].txt", path: "file7.txt", want: false},
+		{pattern: "file[0-9.txt", path: "file[0-9.txt", want: true},
+		{pattern: "a.b", path: "axb", want: false},
+		{pattern: "a+b(c)", path: "a+b(c)", want: true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern)
+		if err != nil {
+			t.Errorf("globToRegexp(%q) failed: %s", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGlobRoot(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "src/main.go", want: "src/main.go"},
+		{pattern: "src/*.go", want: "src"},
+		{pattern: "src/pkg/**/*.go", want: "src/pkg"},
+		{pattern: "src/ma*.go", want: "src"},
+		{pattern: "*.go", want: "."},
+		{pattern: "/abs/**", want: "/abs"},
+	}
+	for _, tt := range tests {
+		if got := globRoot(tt.pattern); got != tt.want {
+			t.Errorf("globRoot(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"main.go", "README.md", "src/a.go", "src/b.txt", "src/pkg/c.go", "docs/d.md"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var abs = func(files ...string) []string {
+		var ret = make([]string, len(files))
+		for i, f := range files {
+			ret[i] = filepath.Join(dir, f)
+		}
+		return ret
+	}
+	var tests = []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{name: "one folder", patterns: []string{"*.go"}, want: abs("main.go")},
+		{name: "any folder", patterns: []string{"**/*.go"}, want: abs("main.go", "src/a.go", "src/pkg/c.go")},
+		{name: "a file", patterns: []string{"README.md"}, want: abs("README.md")},
+		{name: "a folder", patterns: []string{"src"}, want: abs("src/a.go", "src/b.txt", "src/pkg/c.go")},
+		{name: "folder by wildcard", patterns: []string{"do*"}, want: abs("docs/d.md")},
+		{name: "no duplicates", patterns: []string{"src/*.go", "**/a.go"}, want: abs("src/a.go")},
+		{name: "missing", patterns: []string{"missing/*.go", "missing.txt"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patterns = make([]string, len(tt.patterns))
+			for i, p := range tt.patterns {
+				patterns[i] = filepath.Join(dir, p)
+			}
+			got, err := Glob(patterns...)
+			if err != nil {
+				t.Fatalf("Glob failed: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Glob(%q) = %q, want %q", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
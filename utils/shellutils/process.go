@@ -0,0 +1,270 @@
+package shellutils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//Process a shell command running in the background, in a process group of its own so it can be stopped
+//together with the processes it started
+type Process struct {
+	command *exec.Cmd
+	opt     CommandOptions
+	mutex   sync.Mutex
+	out     strings.Builder
+	err     strings.Builder
+	outRead int           //How much of out was returned by ReadOut
+	errRead int           //How much of err was returned by ReadErr
+	matched int           //How much of out was consumed by Expect
+	changed chan struct{} //Closed, and replaced, whenever output is collected
+	tty     *os.File      //The terminal of the command when it runs with opt.Pty
+	done    chan struct{}
+	result  ShellResult
+}
+
+//StartShellCommand start a command using the shell and return without waiting for it to end. The output is
+//collected, and written to opt.Output, while the command runs. opt.OnLine is not supported
+func StartShellCommand(commandToRun string, opt CommandOptions) (*Process, error) {
+	if opt.OnLine != nil {
+		return nil, fmt.Errorf("onLine is not supported for commands that run in the background")
+	}
+	if opt.Shell == "" {
+		opt.Shell = "/bin/bash"
+	}
+
+	command := exec.Command(opt.Shell, "-c", commandToRun)
+	command.Env = opt.environment()
+	command.Dir = opt.Cwd
+
+	p := &Process{command: command, opt: opt, changed: make(chan struct{}), done: make(chan struct{})}
+	var wg sync.WaitGroup
+	if opt.Pty {
+		tty, err := startPty(command)
+		if err != nil {
+			return nil, err
+		}
+		p.tty = tty
+		go writeInput(tty, opt)
+		wg.Add(1)
+		go p.collect(tty, &p.out, &wg)
+	} else {
+		setProcessGroup(command)
+		stdout, _ := command.StdoutPipe()
+		stderr, _ := command.StderrPipe()
+		stdin, _ := command.StdinPipe()
+		if err := command.Start(); err != nil {
+			return nil, err
+		}
+		go func() {
+			defer stdin.Close()
+			writeInput(stdin, opt)
+		}()
+		wg.Add(2)
+		go p.collect(stdout, &p.out, &wg)
+		go p.collect(stderr, &p.err, &wg)
+	}
+
+	go func() {
+		wg.Wait()
+		err := command.Wait()
+		if p.tty != nil {
+			p.tty.Close()
+		}
+		p.mutex.Lock()
+		p.result.Out = p.out.String()
+		p.result.Err = p.err.String()
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			p.result.Code = exiterr.ExitCode()
+		} else if err != nil {
+			p.result.Code = 1
+		}
+		p.mutex.Unlock()
+		close(p.done)
+	}()
+
+	if opt.Timeout > 0 {
+		timer := time.AfterFunc(time.Duration(opt.Timeout)*time.Second, func() { p.Stop(DefaultStopGrace) })
+		go func() {
+			<-p.done
+			timer.Stop()
+		}()
+	}
+	return p, nil
+}
+
+//collect read r into buf as it is written, so prompts that do not end a line can be expected, and write every
+//line to the output of the process
+func (p *Process) collect(r io.Reader, buf *strings.Builder, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var chunk = make([]byte, 4096)
+	var partial string //The end of the output, after its last line end
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			text := string(chunk[:n])
+			if p.tty != nil {
+				text = strings.ReplaceAll(text, "\r\n", "\n")
+			}
+			p.mutex.Lock()
+			buf.WriteString(text)
+			lines := strings.Split(partial+text, "\n")
+			partial = lines[len(lines)-1]
+			p.writeLines(lines[:len(lines)-1])
+			close(p.changed)
+			p.changed = make(chan struct{})
+			p.mutex.Unlock()
+		}
+		if err != nil {
+			if partial != "" {
+				p.mutex.Lock()
+				p.writeLines([]string{partial})
+				p.mutex.Unlock()
+			}
+			return
+		}
+	}
+}
+
+//writeLines write lines to the output of the process, unless it is quiet
+func (p *Process) writeLines(lines []string) {
+	if p.opt.Output == nil || p.opt.Quiet {
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprint(p.opt.Output, p.opt.Prefix+strings.TrimRight(line, "\r")+"\n")
+	}
+}
+
+//Expect wait until stdout, after what previous calls to Expect matched, matches re. Returns the match and its
+//groups, as FindStringSubmatch does. Fails if the command ends, or timeout passes, before stdout matches re
+func (p *Process) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	var ended bool
+	for {
+		p.mutex.Lock()
+		out := p.out.String()[p.matched:]
+		if loc := re.FindStringSubmatchIndex(out); loc != nil {
+			p.matched += loc[1]
+			p.mutex.Unlock()
+			return re.FindStringSubmatch(out[loc[0]:loc[1]]), nil
+		}
+		changed := p.changed
+		p.mutex.Unlock()
+
+		if ended {
+			return nil, fmt.Errorf("Command ended before its output matched %s, last output %q", re, tail(out))
+		}
+		select {
+		case <-changed:
+		case <-p.done:
+			ended = true
+		case <-deadline.C:
+			return nil, fmt.Errorf("Timeout waiting for output that matches %s, last output %q", re, tail(out))
+		}
+	}
+}
+
+//tail the last line of text, for errors that show where the output stopped
+func tail(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+//Send write text to the terminal of the command. Only commands that run with opt.Pty can be sent text
+func (p *Process) Send(text string) error {
+	if p.tty == nil {
+		return fmt.Errorf("Text can only be sent to commands that run with pty")
+	}
+	if !p.IsRunning() {
+		return fmt.Errorf("Command already ended")
+	}
+	_, err := p.tty.Write([]byte(text))
+	return err
+}
+
+//Pid the process id of the shell running the command
+func (p *Process) Pid() int {
+	return p.command.Process.Pid
+}
+
+//Done closed when the command ended and all of its output was read
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+//IsRunning true until the command ends and its output is closed
+func (p *Process) IsRunning() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+//Wait wait for the command to end and return its result. Code is -1 if it was killed by a signal
+func (p *Process) Wait() *ShellResult {
+	<-p.done
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := p.result
+	return &ret
+}
+
+//ReadOut the standard output written since the last call to ReadOut
+func (p *Process) ReadOut() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := p.out.String()[p.outRead:]
+	p.outRead += len(ret)
+	return ret
+}
+
+//ReadErr the standard error written since the last call to ReadErr
+func (p *Process) ReadErr() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := p.err.String()[p.errRead:]
+	p.errRead += len(ret)
+	return ret
+}
+
+//Signal send sig to the process group of the command. Does nothing if the command already ended
+func (p *Process) Signal(sig syscall.Signal) error {
+	if !p.IsRunning() {
+		return nil
+	}
+	err := signalProcessGroup(p.command, sig)
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
+
+//DefaultStopGrace how long Stop waits for the command to end after SIGTERM, before it kills it
+const DefaultStopGrace = 3 * time.Second
+
+//Stop terminate the process group of the command, and kill it if it did not end within grace
+func (p *Process) Stop(grace time.Duration) {
+	if p.Signal(syscall.SIGTERM) != nil {
+		p.Signal(syscall.SIGKILL)
+	}
+	select {
+	case <-p.done:
+		return
+	case <-time.After(grace):
+	}
+	p.Signal(syscall.SIGKILL)
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+	}
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+// +build !windows
+
+package shellutils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+}
+
+func setProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signalProcessGroup(command *exec.Cmd, sig syscall.Signal) error {
+	//A negative pid signals the whole group, whose id is the pid of its leader
+	return syscall.Kill(-command.Process.Pid, sig)
+}
+
+//ParseSignal the signal named name, e.g. SIGTERM, TERM or 15
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("Unknown signal %s", name)
+}
+
+//startPty start command with a new pseudo terminal as its stdin, stdout and stderr, and return the terminal.
+//The command is the leader of a new session, so it also has a process group of its own
+func startPty(command *exec.Cmd) (*os.File, error) {
+	return pty.Start(command)
+}
@@ -0,0 +1,31 @@
+package shellutils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+func setProcessGroup(command *exec.Cmd) {}
+
+//signalProcessGroup windows has no process groups nor signals, so the command is killed
+func signalProcessGroup(command *exec.Cmd, sig syscall.Signal) error {
+	return command.Process.Kill()
+}
+
+//ParseSignal the signal named name. Only SIGTERM and SIGKILL are known on windows
+func ParseSignal(name string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "TERM", "15":
+		return syscall.SIGTERM, nil
+	case "KILL", "9":
+		return syscall.SIGKILL, nil
+	}
+	return 0, fmt.Errorf("Unknown signal %s", name)
+}
+
+func startPty(command *exec.Cmd) (*os.File, error) {
+	return nil, fmt.Errorf("pty is not supported on windows")
+}
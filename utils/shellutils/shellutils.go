@@ -1,11 +1,20 @@
 package shellutils
 
 import (
-	"context"
+	"bufio"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
+	"os/user"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/sagiforbes/banai/utils/sshutils"
@@ -21,12 +30,73 @@ type ShellResult struct {
 
 //CommandOptions how to run the a shell command
 type CommandOptions struct {
-	Shell    string   `json:"shell,omitempty"`
-	In       string   `json:"in,omitempty"`
-	Ins      []string `json:"ins,omitempty"`
-	Env      []string `json:"env,omitempty"`
-	Timeout  int      `json:"timeout,omitempty"`
-	SecretID string   `json:"secretId,omitempty"`
+	Shell    string            `json:"shell,omitempty"`
+	In       string            `json:"in,omitempty"`
+	Ins      []string          `json:"ins,omitempty"`
+	Env      []string          `json:"env,omitempty"`
+	EnvMap   map[string]string `json:"envMap,omitempty"`   //Environment variables by name, set after Env
+	ClearEnv bool              `json:"clearEnv,omitempty"` //Run with only Env and EnvMap, instead of adding them to the environment of banai
+	Cwd      string            `json:"cwd,omitempty"`      //Working directory of the command. Default is the current directory
+	Timeout  int               `json:"timeout,omitempty"`
+	SecretID string            `json:"secretId,omitempty"`
+	//InsecureIgnoreHostKey let git accept any host key when SecretID is of an ssh key. Otherwise the host must be known
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"`
+	Quiet                 bool   `json:"quiet,omitempty"`  //Do not write the output lines to Output
+	Prefix                string `json:"prefix,omitempty"` //Written before every output line
+	Pty                   bool   `json:"pty,omitempty"`    //Run in a pseudo terminal, for commands that prompt only on a terminal. stderr is written to Out
+	//Check fail the command when it exits with a code other than 0, see CheckResult. nil for the default of the caller
+	Check *bool `json:"check,omitempty"`
+	//OnLine is called with every line the command writes, and the stream it was written to, out or err.
+	//The command is killed if OnLine returns an error or panics. The error is returned, and the panic raised
+	//again, once the command ended. Scripts set it through the options of the shell package
+	OnLine func(line string, stream string) error `json:"onLine,omitempty"`
+	Output io.Writer                              `json:"-"` //Where the output lines are written while the command runs
+	//Track is called once the command started, with a function that kills it and every process it started. The
+	//function it returns is called when the command ended. The shell package kills the commands of aborted scripts so
+	Track func(kill func()) (untrack func()) `json:"-"`
+}
+
+//Output streams of a command
+const (
+	StreamOut = "out"
+	StreamErr = "err"
+)
+
+//environment the environment variables of a command run with opt
+func (opt CommandOptions) environment() []string {
+	var env = make([]string, 0)
+	if !opt.ClearEnv {
+		env = append(env, os.Environ()...)
+	}
+	env = append(env, opt.Env...)
+	var names = make([]string, 0, len(opt.EnvMap))
+	for name := range opt.EnvMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+opt.EnvMap[name])
+	}
+	return env
+}
+
+//checkErrLines how many of the last lines of stderr are in the error of CheckResult
+const checkErrLines = 10
+
+//CheckResult an error describing command, its exit code and the tail of its stderr, if result has a code other than 0
+func CheckResult(command string, result *ShellResult) error {
+	if result == nil || result.Code == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(result.Err, "\r\n"), "\n")
+	if len(lines) > checkErrLines {
+		lines = lines[len(lines)-checkErrLines:]
+	}
+	tail := strings.Join(lines, "\n")
+	if tail == "" {
+		return fmt.Errorf("Command %s failed with exit code %d", command, result.Code)
+	}
+	return fmt.Errorf("Command %s failed with exit code %d: %s", command, result.Code, tail)
 }
 
 //DefaultBashCommandOptions default for running with bash
@@ -36,70 +106,181 @@ func DefaultBashCommandOptions() CommandOptions {
 	return ret
 }
 
-//RunShellCommand execute a command using the shell
-func RunShellCommand(commandToRun string, cmdOpt ...CommandOptions) (*ShellResult, error) {
-	if cmdOpt == nil {
-		cmdOpt = []CommandOptions{DefaultBashCommandOptions()}
-	} else {
-		if cmdOpt[0].Shell == "" {
-			cmdOpt[0].Shell = "/bin/bash"
+type outputLine struct {
+	stream string
+	text   string //The line as written, with its line end
+}
+
+//readLines send the lines of r to lines, as they are written
+func readLines(stream string, r io.Reader, lines chan<- outputLine, wg *sync.WaitGroup) {
+	defer wg.Done()
+	reader := bufio.NewReader(r)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			lines <- outputLine{stream: stream, text: text}
+		}
+		if err != nil {
+			return
 		}
+	}
+}
 
+//onLinePanic a panic of OnLine, raised again by the caller once the command ended
+type onLinePanic struct {
+	value interface{}
+}
+
+func (p onLinePanic) Error() string {
+	return fmt.Sprint("OnLine panicked: ", p.value)
+}
+
+//raiseOnLinePanic raise again the panic of OnLine that err holds, if it holds one
+func raiseOnLinePanic(err error) {
+	if p, ok := err.(onLinePanic); ok {
+		panic(p.value)
 	}
+}
 
-	var finalCommand = make([]string, 0)
+//callOnLine pass line to opt.OnLine, and return its panic as an onLinePanic error
+func callOnLine(opt CommandOptions, line outputLine) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = onLinePanic{value: r}
+		}
+	}()
+	return opt.OnLine(strings.TrimRight(line.text, "\r\n"), line.stream)
+}
+
+//collectOutput read the stdout and stderr of a running command line by line, until both are closed. Every line is
+//written to opt.Output and passed to opt.OnLine, from the calling goroutine, and collected into ret. kill is
+//called if OnLine fails, and the output is still read to its end so the command can be waited for
+func collectOutput(kill func(), stdout, stderr io.Reader, opt CommandOptions, ret *ShellResult) error {
+	var lines = make(chan outputLine)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go readLines(StreamOut, stdout, lines, &wg)
+	go readLines(StreamErr, stderr, lines, &wg)
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
 
-	var shellCmd = cmdOpt[0].Shell
+	var out, errOut strings.Builder
+	var lineErr error
+	for line := range lines {
+		if line.stream == StreamOut {
+			out.WriteString(line.text)
+		} else {
+			errOut.WriteString(line.text)
+		}
+		if lineErr != nil {
+			continue
+		}
+		if opt.Output != nil && !opt.Quiet {
+			fmt.Fprint(opt.Output, opt.Prefix+strings.TrimRight(line.text, "\r\n")+"\n")
+		}
+		if opt.OnLine != nil {
+			if lineErr = callOnLine(opt, line); lineErr != nil {
+				kill()
+			}
+		}
+	}
+	ret.Out = out.String()
+	ret.Err = errOut.String()
+	return lineErr
+}
 
-	finalCommand = append(finalCommand, "-c")
-	finalCommand = append(finalCommand, commandToRun)
+//writeInput write the in and ins lines of opt to w
+func writeInput(w io.Writer, opt CommandOptions) {
+	if opt.In != "" {
+		w.Write([]byte(opt.In + "\n"))
+	}
+	for _, line := range opt.Ins {
+		w.Write([]byte(line + "\n"))
+	}
+}
 
-	var command *exec.Cmd
-	if cmdOpt != nil && cmdOpt[0].Timeout > 0 {
-		ctx, cancelFunc := context.WithTimeout(context.Background(), time.Duration(cmdOpt[0].Timeout)*time.Second)
-		defer cancelFunc()
-		command = exec.CommandContext(ctx, shellCmd, finalCommand...)
-	} else {
-		command = exec.Command(shellCmd, finalCommand...)
+//RunShellCommand execute a command using the shell. The output is read while the command runs, see CommandOptions
+func RunShellCommand(commandToRun string, cmdOpt ...CommandOptions) (*ShellResult, error) {
+	var shellCmd = "/bin/bash"
+	if cmdOpt != nil && cmdOpt[0].Shell != "" {
+		shellCmd = cmdOpt[0].Shell
 	}
+	return RunCommand(shellCmd, []string{"-c", commandToRun}, cmdOpt...)
+}
+
+//killedOutputWait how long the output of a killed command is still read. A process that left the process group of
+//the command may hold it open, so it is closed after that
+const killedOutputWait = time.Second
 
-	command.Env = append(command.Env, os.Environ()...)
-	if cmdOpt[0].Env != nil {
-		command.Env = append(command.Env, cmdOpt[0].Env...)
+//RunCommand execute program with args, without a shell, so args are passed as they are. opt.Shell is not used.
+//The command runs in a process group of its own, so a timeout kills it with every process it started
+func RunCommand(program string, args []string, cmdOpt ...CommandOptions) (*ShellResult, error) {
+	if cmdOpt == nil {
+		cmdOpt = []CommandOptions{{}}
 	}
 
-	cmdStdOutPipe, _ := command.StdoutPipe()
-	cmdStdErrPipe, _ := command.StderrPipe()
-	procWriter, _ := command.StdinPipe()
+	command := exec.Command(program, args...)
+	command.Env = cmdOpt[0].environment()
+	command.Dir = cmdOpt[0].Cwd
 
 	var err error
-	err = command.Start()
-	if err != nil {
-		return nil, err
+	var cmdStdOutPipe, cmdStdErrPipe io.ReadCloser
+	if cmdOpt[0].Pty {
+		var tty *os.File
+		if tty, err = startPty(command); err != nil {
+			return nil, err
+		}
+		defer tty.Close()
+		//The terminal has a single output, read as stdout
+		cmdStdOutPipe, cmdStdErrPipe = tty, ioutil.NopCloser(strings.NewReader(""))
+		//Closing the terminal would hang up the command, so its input is only written
+		go writeInput(tty, cmdOpt[0])
+	} else {
+		setProcessGroup(command)
+		cmdStdOutPipe, _ = command.StdoutPipe()
+		cmdStdErrPipe, _ = command.StderrPipe()
+		procWriter, _ := command.StdinPipe()
+		if err = command.Start(); err != nil {
+			return nil, err
+		}
+		//Write the input while the output is read, and close stdin so commands that read it to its end do not hang
+		go func() {
+			defer procWriter.Close()
+			writeInput(procWriter, cmdOpt[0])
+		}()
 	}
 
-	if cmdOpt != nil && cmdOpt[0].In != "" {
-		procWriter.Write([]byte(cmdOpt[0].In))
-		procWriter.Write([]byte("\n"))
+	var killOnce sync.Once
+	kill := func() {
+		killOnce.Do(func() {
+			signalProcessGroup(command, syscall.SIGKILL)
+			time.AfterFunc(killedOutputWait, func() {
+				cmdStdOutPipe.Close()
+				cmdStdErrPipe.Close()
+			})
+		})
 	}
-	if cmdOpt != nil && cmdOpt[0].Ins != nil {
-		for _, line := range cmdOpt[0].Ins {
-			procWriter.Write([]byte(line))
-			procWriter.Write([]byte("\n"))
-		}
+	if cmdOpt[0].Timeout > 0 {
+		timer := time.AfterFunc(time.Duration(cmdOpt[0].Timeout)*time.Second, kill)
+		defer timer.Stop()
 	}
-	var buf []byte
-	ret := &ShellResult{}
-	buf, err = ioutil.ReadAll(cmdStdOutPipe)
-	if err == nil {
-		ret.Out = string(buf)
+	if cmdOpt[0].Track != nil {
+		defer cmdOpt[0].Track(kill)()
 	}
-	buf, err = ioutil.ReadAll(cmdStdErrPipe)
-	if err == nil {
-		ret.Err = string(buf)
+
+	ret := &ShellResult{}
+	lineErr := collectOutput(kill, cmdStdOutPipe, cmdStdErrPipe, cmdOpt[0], ret)
+	if cmdOpt[0].Pty {
+		ret.Out = strings.ReplaceAll(ret.Out, "\r\n", "\n")
 	}
 
 	err = command.Wait()
+	if lineErr != nil {
+		raiseOnLinePanic(lineErr)
+		return nil, lineErr
+	}
 	if err == nil {
 		ret.Code = 0
 	} else {
@@ -116,58 +297,370 @@ func RunShellCommand(commandToRun string, cmdOpt ...CommandOptions) (*ShellResul
 
 //ShellSSHConfig connection configuration
 type ShellSSHConfig struct {
-	Address        string `json:"address,omitempty"`
+	Address string `json:"address,omitempty"`
+	//Host a host alias of the OpenSSH config file, whose settings fill those not set here. See Resolve
+	Host           string `json:"host,omitempty"`
+	SSHConfigFile  string `json:"sshConfigFile,omitempty"` //OpenSSH config file of Host. Default is ~/.ssh/config
 	User           string `json:"user,omitempty"`
 	Password       string `json:"password,omitempty"`
 	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
 	Passphrase     string `json:"passphrase,omitempty"`
 	SecretID       string `json:"secretId,omitempty"`
+	//How the key of the host is verified. By default it must be in ~/.ssh/known_hosts
+	KnownHostsFile        string `json:"knownHostsFile,omitempty"`        //known_hosts file to verify the host key with
+	HostKeyFingerprint    string `json:"hostKeyFingerprint,omitempty"`    //The host key must have this fingerprint, e.g. SHA256:...
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"` //Accept any host key
+	//JumpHosts the hosts to connect through, like ProxyJump of OpenSSH. The first is connected to directly, and
+	//each of the others, and the host of the config last, from the one before it
+	JumpHosts []ShellSSHConfig `json:"jumpHosts,omitempty"`
 }
 
-//RunRemoteShell execute a command on remote shell
-func RunRemoteShell(sshConf ShellSSHConfig, cmd string) (*ShellResult, error) {
-	var sshClientConf *ssh.ClientConfig
-	var e error
+//envNameRegexp what an environment variable name sent to a remote shell may be
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//ShellQuote quote text as a single argument of a POSIX shell
+func ShellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+//remoteCommand cmd prefixed by the environment variables and working directory of opt. They are set by the remote
+//shell, since ssh servers usually refuse to set environment variables for their clients
+func remoteCommand(cmd string, opt CommandOptions) (string, error) {
+	var env = append([]string{}, opt.Env...)
+	var names = make([]string, 0, len(opt.EnvMap))
+	for name := range opt.EnvMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+opt.EnvMap[name])
+	}
 
+	var prefix strings.Builder
+	for _, v := range env {
+		eqIdx := strings.IndexRune(v, '=')
+		if eqIdx < 0 || !envNameRegexp.MatchString(v[:eqIdx]) {
+			return "", fmt.Errorf("Invalid environment variable %s", v)
+		}
+		prefix.WriteString("export " + v[:eqIdx] + "=" + ShellQuote(v[eqIdx+1:]) + "; ")
+	}
+	if opt.Cwd != "" {
+		prefix.WriteString("cd " + ShellQuote(opt.Cwd) + " && ")
+	}
+	return prefix.String() + cmd, nil
+}
+
+//jumpHosts the jump hosts of sshConf. Those without a user have the user of sshConf
+func (sshConf ShellSSHConfig) jumpHosts() []ShellSSHConfig {
+	var hosts = make([]ShellSSHConfig, 0, len(sshConf.JumpHosts))
+	for _, host := range sshConf.JumpHosts {
+		if host.User == "" {
+			host.User = sshConf.User
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+//maxProxyJumps how many hosts ProxyJump of the OpenSSH config may chain, so a loop in it fails
+const maxProxyJumps = 10
+
+//Resolve sshConf with the settings of its Host alias in the OpenSSH config file: HostName and Port make the
+//Address, User the user (default is the local user), IdentityFile the private key when there is no password,
+//UserKnownHostsFile the known hosts file and ProxyJump the jump hosts. What sshConf sets wins over the file.
+//Jump hosts with a Host alias are resolved too. sshConf is returned as is if neither has a Host
+func (sshConf ShellSSHConfig) Resolve() (ShellSSHConfig, error) {
+	resolved, e := sshConf.resolve(0)
+	if e != nil {
+		return sshConf, e
+	}
+	if resolved.User == "" && resolved.Host != "" {
+		if u, e := user.Current(); e == nil {
+			resolved.User = u.Username
+		}
+	}
+	return resolved, nil
+}
+
+func (sshConf ShellSSHConfig) resolve(depth int) (ShellSSHConfig, error) {
+	if depth > maxProxyJumps {
+		return sshConf, fmt.Errorf("ProxyJump of %s chains more than %d hosts", sshConf.Host, maxProxyJumps)
+	}
+	jumpHosts, e := resolveJumpHosts(sshConf.JumpHosts, depth)
+	if e != nil {
+		return sshConf, e
+	}
+	sshConf.JumpHosts = jumpHosts
+	if sshConf.Host == "" {
+		return sshConf, nil
+	}
+
+	host, e := sshutils.LookupHost(sshConf.SSHConfigFile, sshConf.Host)
+	if e != nil {
+		return sshConf, fmt.Errorf("SSH config of host %s: %v", sshConf.Host, e)
+	}
 	if sshConf.Address == "" {
-		return nil, fmt.Errorf("sshConfig target host Address not set")
+		var hostName, port = host.HostName, host.Port
+		if hostName == "" {
+			hostName = sshConf.Host
+		}
+		if port == "" {
+			port = "22"
+		}
+		sshConf.Address = net.JoinHostPort(hostName, port)
 	}
 	if sshConf.User == "" {
-		return nil, fmt.Errorf("sshConfig User not set")
+		sshConf.User = host.User
+	}
+	//OpenSSH skips identity files that do not exist
+	if sshConf.Password == "" && sshConf.PrivateKeyFile == "" && host.IdentityFile != "" {
+		if _, e := os.Stat(host.IdentityFile); e == nil {
+			sshConf.PrivateKeyFile = host.IdentityFile
+		}
+	}
+	if sshConf.KnownHostsFile == "" {
+		sshConf.KnownHostsFile = host.UserKnownHostsFile
+	}
+	if len(sshConf.JumpHosts) == 0 && host.ProxyJump != "" && !strings.EqualFold(host.ProxyJump, "none") {
+		var jumps = make([]ShellSSHConfig, 0)
+		for _, jump := range strings.Split(host.ProxyJump, ",") {
+			jumps = append(jumps, parseProxyJump(strings.TrimSpace(jump), sshConf.SSHConfigFile))
+		}
+		if sshConf.JumpHosts, e = resolveJumpHosts(jumps, depth); e != nil {
+			return sshConf, e
+		}
 	}
+	return sshConf, nil
+}
+
+//resolveJumpHosts resolve the jump hosts that have a Host alias. The jump hosts of a jump host, from ProxyJump,
+//are connected to before it
+func resolveJumpHosts(jumpHosts []ShellSSHConfig, depth int) ([]ShellSSHConfig, error) {
+	var resolved = make([]ShellSSHConfig, 0, len(jumpHosts))
+	for _, jump := range jumpHosts {
+		if jump.Host == "" {
+			resolved = append(resolved, jump)
+			continue
+		}
+		r, e := jump.resolve(depth + 1)
+		if e != nil {
+			return nil, e
+		}
+		resolved = append(resolved, r.JumpHosts...)
+		r.JumpHosts = nil
+		resolved = append(resolved, r)
+	}
+	return resolved, nil
+}
 
+//parseProxyJump the jump host of a ProxyJump entry, [user@]host[:port]. host may be an alias of configFile
+func parseProxyJump(jump, configFile string) ShellSSHConfig {
+	var conf = ShellSSHConfig{SSHConfigFile: configFile}
+	if at := strings.LastIndex(jump, "@"); at >= 0 {
+		conf.User = jump[:at]
+		jump = jump[at+1:]
+	}
+	conf.Host = jump
+	if host, port, e := net.SplitHostPort(jump); e == nil {
+		//An explicit port wins over the config, so the host name must be resolved first
+		hostConf, e := sshutils.LookupHost(configFile, host)
+		if e == nil && hostConf.HostName != "" {
+			conf.Address = net.JoinHostPort(hostConf.HostName, port)
+		} else {
+			conf.Address = net.JoinHostPort(host, port)
+		}
+		conf.Host = host
+	}
+	return conf
+}
+
+//Validate check that sshConf, and its jump hosts, have what connecting needs
+func (sshConf ShellSSHConfig) Validate() error {
+	if sshConf.Address == "" {
+		return fmt.Errorf("sshConfig target host Address not set")
+	}
+	if sshConf.User == "" {
+		return fmt.Errorf("sshConfig User not set")
+	}
+	for i, host := range sshConf.jumpHosts() {
+		if host.Address == "" {
+			return fmt.Errorf("sshConfig jump host %d Address not set", i+1)
+		}
+		if len(host.JumpHosts) > 0 {
+			return fmt.Errorf("sshConfig jump host %s has jump hosts of its own. List all of them in the jumpHosts of the target", host.Address)
+		}
+	}
+	return nil
+}
+
+//clientConfig how to connect to the host of sshConf, and verify its key. The keys of the running ssh-agent are
+//used without a password, after the private key if there is one, and the returned connection to the agent must be
+//closed after dialing
+func (sshConf ShellSSHConfig) clientConfig() (*ssh.ClientConfig, io.Closer, error) {
+	var sshClientConf *ssh.ClientConfig
+	var agentConn io.Closer
+	var e error
 	if sshConf.Password != "" {
 		sshClientConf = sshutils.CreateFromUserPassword(sshConf.User, sshConf.Password)
-	} else {
-		if sshConf.PrivateKeyFile != "" {
-			sshClientConf, e = sshutils.CreateFromPrivateKeyFile(sshConf.User, sshConf.PrivateKeyFile, sshConf.Passphrase)
-			if e != nil {
-				return nil, e
-			}
+	} else if sshConf.PrivateKeyFile != "" {
+		sshClientConf, agentConn, e = sshConf.keyFileConfig()
+		if e != nil {
+			return nil, nil, e
+		}
+	} else if sshutils.AgentAvailable() {
+		sshClientConf, agentConn, e = sshutils.CreateFromAgent(sshConf.User)
+		if e != nil {
+			return nil, nil, e
 		}
 	}
 
-	var client *sshutils.Client
-	client, e = sshutils.Dial(sshConf.Address, sshClientConf)
+	if sshClientConf == nil {
+		return nil, nil, fmt.Errorf("sshConfig of %s has no password nor privateKeyFile, and no ssh-agent is running", sshConf.Address)
+	}
+	e = sshutils.SetHostKeyVerification(sshClientConf, sshConf.Address, sshutils.HostKeyOptions{
+		KnownHostsFile: sshConf.KnownHostsFile,
+		Fingerprint:    sshConf.HostKeyFingerprint,
+		Insecure:       sshConf.InsecureIgnoreHostKey,
+	})
+	if e != nil {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, nil, e
+	}
+	return sshClientConf, agentConn, nil
+}
+
+//keyFileConfig how to connect with the private key file of sshConf. As with OpenSSH, the keys of the running
+//ssh-agent are tried after it, and a key whose passphrase is not given is expected to be in the agent
+func (sshConf ShellSSHConfig) keyFileConfig() (*ssh.ClientConfig, io.Closer, error) {
+	var signers = make([]ssh.Signer, 0, 1)
+	signer, e := sshutils.PrivateKeyFileSigner(sshConf.PrivateKeyFile, sshConf.Passphrase)
+	if e == nil {
+		signers = append(signers, signer)
+	} else if _, missing := e.(*ssh.PassphraseMissingError); !missing || !sshutils.AgentAvailable() {
+		return nil, nil, e
+	}
+	if sshutils.AgentAvailable() {
+		sshClientConf, agentConn, e := sshutils.CreateFromAgent(sshConf.User, signers...)
+		//The key file is enough when the agent cannot be reached
+		if e == nil || len(signers) == 0 {
+			return sshClientConf, agentConn, e
+		}
+	}
+	return sshutils.CreateFromSigners(sshConf.User, signers...), nil, nil
+}
+
+//DialSSH connect to the host of sshConf, through its jump hosts if it has any. sshConf is resolved first, see Resolve
+func DialSSH(sshConf ShellSSHConfig) (*sshutils.Client, error) {
+	sshConf, e := sshConf.Resolve()
+	if e != nil {
+		return nil, e
+	}
+	if e = sshConf.Validate(); e != nil {
+		return nil, e
+	}
+
+	//The agent signs during the handshakes, so its connections are closed once all hosts are connected
+	var agentConns = make([]io.Closer, 0)
+	defer func() {
+		for _, c := range agentConns {
+			c.Close()
+		}
+	}()
+	var hops = make([]sshutils.Hop, 0, len(sshConf.JumpHosts))
+	for _, host := range sshConf.jumpHosts() {
+		conf, agentConn, e := host.clientConfig()
+		if e != nil {
+			return nil, e
+		}
+		if agentConn != nil {
+			agentConns = append(agentConns, agentConn)
+		}
+		hops = append(hops, sshutils.Hop{Address: host.Address, Config: conf})
+	}
+	conf, agentConn, e := sshConf.clientConfig()
+	if e != nil {
+		return nil, e
+	}
+	if agentConn != nil {
+		agentConns = append(agentConns, agentConn)
+	}
+	return sshutils.DialVia(hops, sshConf.Address, conf)
+}
+
+//RunRemoteShell execute a command on remote shell, on a connection of its own. See RunRemoteCommand
+func RunRemoteShell(sshConf ShellSSHConfig, cmd string, cmdOpt ...CommandOptions) (*ShellResult, error) {
+	client, e := DialSSH(sshConf)
 	if e != nil {
 		return nil, e
 	}
 	defer client.Close()
+	return RunRemoteCommand(client, cmd, cmdOpt...)
+}
+
+//RunRemoteCommand execute a command on the host client is connected to. The output is read while the command runs,
+//like RunShellCommand. env, envMap, cwd, in, ins and timeout of cmdOpt are supported. Code is the exit status of
+//the remote command, or -1 if it timed out
+func RunRemoteCommand(client *sshutils.Client, cmd string, cmdOpt ...CommandOptions) (*ShellResult, error) {
+	var opt CommandOptions
+	if len(cmdOpt) > 0 {
+		opt = cmdOpt[0]
+	}
+	remoteCmd, e := remoteCommand(cmd, opt)
+	if e != nil {
+		return nil, e
+	}
 
-	stdout, stderr, e := client.Cmd(cmd)
+	session, e := client.NewSession()
 	if e != nil {
 		return nil, e
 	}
+	defer session.Close()
+	stdout, _ := session.StdoutPipe()
+	stderr, _ := session.StderrPipe()
+	stdin, _ := session.StdinPipe()
+	if e = session.Start(remoteCmd); e != nil {
+		return nil, e
+	}
+	go func() {
+		defer stdin.Close()
+		writeInput(stdin, opt)
+	}()
 
-	if len(stderr) > 0 {
-		return &ShellResult{
-			Code: 1,
-			Out:  string(stdout),
-		}, nil
+	var timedOut int32
+	if opt.Timeout > 0 {
+		timer := time.AfterFunc(time.Duration(opt.Timeout)*time.Second, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		})
+		defer timer.Stop()
 	}
 
-	return &ShellResult{
-		Code: 0,
-		Out:  string(stdout),
-	}, nil
+	kill := func() {
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+	}
+	if opt.Track != nil {
+		defer opt.Track(kill)()
+	}
+
+	ret := &ShellResult{}
+	lineErr := collectOutput(kill, stdout, stderr, opt, ret)
+	e = session.Wait()
+	if lineErr != nil {
+		raiseOnLinePanic(lineErr)
+		return nil, lineErr
+	}
+	if atomic.LoadInt32(&timedOut) == 1 {
+		ret.Code = -1
+		return ret, nil
+	}
+	if exitErr, ok := e.(*ssh.ExitError); ok {
+		ret.Code = exitErr.ExitStatus()
+	} else if e != nil {
+		return nil, e
+	}
+	return ret, nil
 }
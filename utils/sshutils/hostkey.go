@@ -0,0 +1,116 @@
+package sshutils
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+//HostKeyOptions how the key a host presents is verified. By default it must be in the known_hosts file of the user
+type HostKeyOptions struct {
+	KnownHostsFile string //known_hosts file to verify with. Default is ~/.ssh/known_hosts
+	Fingerprint    string //When set, the key must have this fingerprint, SHA256:... or MD5 hex, instead of being in KnownHostsFile
+	Insecure       bool   //Accept any key. Connections can then be intercepted by a man in the middle
+}
+
+//ExpandHome replace a leading ~ of path with the home folder of the user
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+//DefaultKnownHostsFile the known_hosts file of the user
+func DefaultKnownHostsFile() string {
+	return ExpandHome("~/.ssh/known_hosts")
+}
+
+//SetHostKeyVerification set how conf verifies the key of the host at address, as opt says
+func SetHostKeyVerification(conf *ssh.ClientConfig, address string, opt HostKeyOptions) error {
+	if opt.Insecure {
+		conf.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return nil
+	}
+	if opt.Fingerprint != "" {
+		conf.HostKeyCallback = fingerprintCallback(opt.Fingerprint)
+		return nil
+	}
+
+	fileName := opt.KnownHostsFile
+	if fileName == "" {
+		fileName = DefaultKnownHostsFile()
+	}
+	fileName = ExpandHome(fileName)
+	if _, err := os.Stat(fileName); err != nil {
+		return fmt.Errorf("Cannot verify the host key of %s, known hosts file %s: %s. Add the host to it, e.g. with ssh-keyscan, pin its hostKeyFingerprint or set insecureIgnoreHostKey", address, fileName, err)
+	}
+	check, err := knownhosts.New(fileName)
+	if err != nil {
+		return err
+	}
+	conf.HostKeyCallback = knownHostsCallback(check, fileName)
+	//Ask the host for a key of a type that is known. Otherwise it may present another key, and fail to verify
+	conf.HostKeyAlgorithms = knownKeyTypes(check, address)
+	return nil
+}
+
+//knownKeyTypes the types of the keys of address in a known hosts file
+func knownKeyTypes(check ssh.HostKeyCallback, address string) []string {
+	_, probeKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewSignerFromKey(probeKey)
+	if err != nil {
+		return nil
+	}
+	//A key that is not known to the file is rejected with the keys that are
+	keyErr, ok := check(address, &net.TCPAddr{IP: net.IPv4zero}, probe.PublicKey()).(*knownhosts.KeyError)
+	if !ok {
+		return nil
+	}
+	var types []string
+	for _, known := range keyErr.Want {
+		types = append(types, known.Key.Type())
+	}
+	return types
+}
+
+func knownHostsCallback(check ssh.HostKeyCallback, fileName string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		switch e := err.(type) {
+		case *knownhosts.KeyError:
+			if len(e.Want) == 0 {
+				return fmt.Errorf("Host key %s of %s is not in %s. Add the host to it, e.g. with ssh-keyscan, pin its hostKeyFingerprint or set insecureIgnoreHostKey", ssh.FingerprintSHA256(key), hostname, fileName)
+			}
+			return fmt.Errorf("Host key %s of %s does not match its key in %s:%d. The host may have a new key, or the connection is intercepted", ssh.FingerprintSHA256(key), hostname, e.Want[0].Filename, e.Want[0].Line)
+		case *knownhosts.RevokedError:
+			return fmt.Errorf("Host key %s of %s is revoked in %s:%d", ssh.FingerprintSHA256(key), hostname, e.Revoked.Filename, e.Revoked.Line)
+		}
+		return err
+	}
+}
+
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if fingerprint == ssh.FingerprintSHA256(key) {
+			return nil
+		}
+		if md5 := strings.TrimPrefix(strings.ToLower(fingerprint), "md5:"); md5 == ssh.FingerprintLegacyMD5(key) {
+			return nil
+		}
+		return fmt.Errorf("Host key %s of %s does not match the pinned fingerprint %s", ssh.FingerprintSHA256(key), hostname, fingerprint)
+	}
+}
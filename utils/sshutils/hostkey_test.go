@@ -0,0 +1,212 @@
+package sshutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newEd25519Key(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECDSAKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+//writeKnownHosts write a known_hosts file with one line per address and key
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "known_hosts")
+	if err := ioutil.WriteFile(fileName, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func knownHostsLine(address string, key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(address)}, key)
+}
+
+var remoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+
+func TestFingerprintCallback(t *testing.T) {
+	key := newEd25519Key(t)
+	other := newEd25519Key(t)
+	var tests = []struct {
+		name        string
+		fingerprint string
+		wantErr     bool
+	}{
+		{name: "sha256", fingerprint: ssh.FingerprintSHA256(key)},
+		{name: "md5", fingerprint: ssh.FingerprintLegacyMD5(key)},
+		{name: "md5 with prefix", fingerprint: "MD5:" + strings.ToUpper(ssh.FingerprintLegacyMD5(key))},
+		{name: "sha256 of another key", fingerprint: ssh.FingerprintSHA256(other), wantErr: true},
+		{name: "md5 of another key", fingerprint: ssh.FingerprintLegacyMD5(other), wantErr: true},
+		{name: "sha256 without prefix", fingerprint: strings.TrimPrefix(ssh.FingerprintSHA256(key), "SHA256:"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fingerprintCallback(tt.fingerprint)("host.example:22", remoteAddr, key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fingerprintCallback(%q) = %v, wantErr %v", tt.fingerprint, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetHostKeyVerification(t *testing.T) {
+	key := newEd25519Key(t)
+	//A revoked key is refused for any host
+	revoked := newEd25519Key(t)
+	fileName := writeKnownHosts(t,
+		knownHostsLine("host.example:22", key),
+		knownHostsLine("other.example:2222", newEd25519Key(t)),
+		knownHostsLine("revoked.example:22", revoked),
+		"@revoked "+knownHostsLine("*", revoked),
+	)
+	var tests = []struct {
+		name    string
+		address string
+		key     ssh.PublicKey
+		wantErr string //Part of the error, empty when the key is accepted
+	}{
+		{name: "known key", address: "host.example:22", key: key},
+		{name: "unknown host", address: "new.example:22", key: key, wantErr: "is not in"},
+		{name: "other port", address: "host.example:2222", key: key, wantErr: "is not in"},
+		{name: "changed key", address: "host.example:22", key: newEd25519Key(t), wantErr: "does not match"},
+		{name: "changed key on port", address: "other.example:2222", key: key, wantErr: "does not match"},
+		{name: "revoked key", address: "revoked.example:22", key: revoked, wantErr: "revoked"},
+		{name: "revoked key of another host", address: "host.example:22", key: revoked, wantErr: "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &ssh.ClientConfig{}
+			if err := SetHostKeyVerification(conf, tt.address, HostKeyOptions{KnownHostsFile: fileName}); err != nil {
+				t.Fatalf("SetHostKeyVerification failed: %s", err)
+			}
+			err := conf.HostKeyCallback(tt.address, remoteAddr, tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("key refused: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetHostKeyVerificationOptions(t *testing.T) {
+	key := newEd25519Key(t)
+	missing := filepath.Join(t.TempDir(), "known_hosts")
+
+	conf := &ssh.ClientConfig{}
+	if err := SetHostKeyVerification(conf, "host.example:22", HostKeyOptions{KnownHostsFile: missing}); err == nil {
+		t.Errorf("SetHostKeyVerification accepted a missing known hosts file")
+	}
+
+	conf = &ssh.ClientConfig{}
+	if err := SetHostKeyVerification(conf, "host.example:22", HostKeyOptions{KnownHostsFile: missing, Insecure: true}); err != nil {
+		t.Fatalf("Insecure failed: %s", err)
+	}
+	if err := conf.HostKeyCallback("host.example:22", remoteAddr, key); err != nil {
+		t.Errorf("Insecure refused a key: %s", err)
+	}
+
+	conf = &ssh.ClientConfig{}
+	opt := HostKeyOptions{KnownHostsFile: missing, Fingerprint: ssh.FingerprintSHA256(key)}
+	if err := SetHostKeyVerification(conf, "host.example:22", opt); err != nil {
+		t.Fatalf("Fingerprint failed: %s", err)
+	}
+	if err := conf.HostKeyCallback("host.example:22", remoteAddr, key); err != nil {
+		t.Errorf("Fingerprint refused its key: %s", err)
+	}
+	if err := conf.HostKeyCallback("host.example:22", remoteAddr, newEd25519Key(t)); err == nil {
+		t.Errorf("Fingerprint accepted another key")
+	}
+}
+
+func TestKnownKeyTypes(t *testing.T) {
+	edKey := newEd25519Key(t)
+	ecKey := newECDSAKey(t)
+	fileName := writeKnownHosts(t,
+		knownHostsLine("both.example:22", ecKey),
+		knownHostsLine("both.example:22", edKey),
+		knownHostsLine("ec.example:22", ecKey),
+	)
+	check, err := knownhosts.New(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		address string
+		want    []string
+	}{
+		{address: "both.example:22", want: []string{ecKey.Type(), edKey.Type()}},
+		{address: "ec.example:22", want: []string{ecKey.Type()}},
+		{address: "new.example:22", want: nil},
+	}
+	for _, tt := range tests {
+		got := knownKeyTypes(check, tt.address)
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("knownKeyTypes(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("No home folder")
+	}
+	var tests = []struct {
+		path string
+		want string
+	}{
+		{path: "~", want: home},
+		{path: "~/.ssh/known_hosts", want: filepath.Join(home, ".ssh", "known_hosts")},
+		{path: "~other/known_hosts", want: "~other/known_hosts"},
+		{path: "/etc/ssh/known_hosts", want: "/etc/ssh/known_hosts"},
+		{path: "known_hosts", want: "known_hosts"},
+	}
+	for _, tt := range tests {
+		if got := ExpandHome(tt.path); got != tt.want {
+			t.Errorf("ExpandHome(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package sshutils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+//folderMode the mode a copied folder gets once all its content is copied
+type folderMode struct {
+	path string
+	mode os.FileMode
+}
+
+//ownerAccess the permissions of mode, with the owner allowed to add to the folder while its content is copied
+func ownerAccess(mode os.FileMode) os.FileMode {
+	return mode.Perm() | 0700
+}
+
+//applyFolderModes set the modes of the copied folders, the deepest first, so read only folders are set after
+//all their content. folders is in the order of the walk, where a folder comes after the folder it is in
+func applyFolderModes(folders []folderMode, chmod func(path string, mode os.FileMode) error) error {
+	for i := len(folders) - 1; i >= 0; i-- {
+		if err := chmod(folders[i].path, folders[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//UploadDir copy the content of localDir, recursively, into remoteDir, which is created if missing. The modes of
+//files and folders are kept, and symbolic links are copied as links
+func (c *Client) UploadDir(localDir, remoteDir string) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	var folders = make([]folderMode, 0)
+	err = filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(remoteDir, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			if err = ftp.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("Cannot create remote folder %s: %v", remotePath, err)
+			}
+			folders = append(folders, folderMode{path: remotePath, mode: info.Mode().Perm()})
+			return ftp.Chmod(remotePath, ownerAccess(info.Mode()))
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				return err
+			}
+			//A link replaces what the remote path has, as a copied file does
+			ftp.Remove(remotePath)
+			if err = ftp.Symlink(target, remotePath); err != nil {
+				return fmt.Errorf("Cannot create remote link %s: %v", remotePath, err)
+			}
+			return nil
+		case info.Mode().IsRegular():
+			if err = c.UploadFile(localPath, remotePath); err != nil {
+				return fmt.Errorf("Cannot upload %s to %s: %v", localPath, remotePath, err)
+			}
+		default:
+			return fmt.Errorf("Cannot upload %s, it is not a file, folder or link", localPath)
+		}
+		return ftp.Chmod(remotePath, info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+	return applyFolderModes(folders, ftp.Chmod)
+}
+
+//checkLocalPath fail if localPath leads out of localDir, by .. in a name the server sent or through a link in a
+//folder above it, which the server could have sent before
+func checkLocalPath(localDir, localPath string) error {
+	rel, err := filepath.Rel(localDir, localPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Refused %s, its path leads out of %s", localPath, localDir)
+	}
+	var parts = strings.Split(rel, string(filepath.Separator))
+	var dir = localDir
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			//The rest of the folders are created by the copy
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Refused %s, it is under the link %s", localPath, dir)
+		}
+	}
+	return nil
+}
+
+//DownloadDir copy the content of remoteDir, recursively, into localDir, which is created if missing. The modes of
+//files and folders are kept, and symbolic links are copied as links. Entries whose path leads out of localDir are
+//refused
+func (c *Client) DownloadDir(remoteDir, localDir string) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	var folders = make([]folderMode, 0)
+	walker := ftp.Walk(remoteDir)
+	for walker.Step() {
+		if err = walker.Err(); err != nil {
+			return err
+		}
+		info := walker.Stat()
+		rel, err := filepath.Rel(remoteDir, walker.Path())
+		if err != nil {
+			return err
+		}
+		localPath := filepath.Join(localDir, filepath.FromSlash(rel))
+		if err = checkLocalPath(localDir, localPath); err != nil {
+			return err
+		}
+		//A link is replaced rather than followed
+		if stat, err := os.Lstat(localPath); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+			if err = os.Remove(localPath); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			if err = os.MkdirAll(localPath, 0755); err != nil {
+				return err
+			}
+			folders = append(folders, folderMode{path: localPath, mode: info.Mode().Perm()})
+			if err = os.Chmod(localPath, ownerAccess(info.Mode())); err != nil {
+				return err
+			}
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := ftp.ReadLink(walker.Path())
+			if err != nil {
+				return err
+			}
+			if err = os.Symlink(target, localPath); err != nil {
+				return err
+			}
+			continue
+		case info.Mode().IsRegular():
+			if err = c.Download(walker.Path(), localPath); err != nil {
+				return fmt.Errorf("Cannot download %s to %s: %v", walker.Path(), localPath, err)
+			}
+		default:
+			return fmt.Errorf("Cannot download %s, it is not a file, folder or link", walker.Path())
+		}
+		if err = os.Chmod(localPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return applyFolderModes(folders, os.Chmod)
+}
+
+//List the items of remoteDir, sorted by name. Links are not followed
+func (c *Client) List(remoteDir string) ([]os.FileInfo, error) {
+	ftp, err := c.sftp()
+	if err != nil {
+		return nil, err
+	}
+	items, err := ftp.ReadDir(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name() < items[j].Name() })
+	return items, nil
+}
+
+//Stat the information of a remote file or folder. Links are followed
+func (c *Client) Stat(remotePath string) (os.FileInfo, error) {
+	ftp, err := c.sftp()
+	if err != nil {
+		return nil, err
+	}
+	return ftp.Stat(remotePath)
+}
+
+//Mkdir create a remote folder and all the folders above it that are missing
+func (c *Client) Mkdir(remoteDir string) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	return ftp.MkdirAll(remoteDir)
+}
+
+//Remove a remote file, link, or folder with all its content
+func (c *Client) Remove(remotePath string) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	info, err := ftp.Lstat(remotePath)
+	if err != nil {
+		return err
+	}
+	return removeAll(ftp, remotePath, info)
+}
+
+//removeAll remove remotePath, whose information is info, and all its content if it is a folder
+func removeAll(ftp *sftp.Client, remotePath string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return ftp.Remove(remotePath)
+	}
+	items, err := ftp.ReadDir(remotePath)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err = removeAll(ftp, path.Join(remotePath, item.Name()), item); err != nil {
+			return err
+		}
+	}
+	return ftp.RemoveDirectory(remotePath)
+}
+
+//Chmod change the mode of a remote file or folder
+func (c *Client) Chmod(remotePath string, mode os.FileMode) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	return ftp.Chmod(remotePath, mode)
+}
+
+//Rename a remote file or folder. Most servers fail if newPath exists
+func (c *Client) Rename(oldPath, newPath string) error {
+	ftp, err := c.sftp()
+	if err != nil {
+		return err
+	}
+	return ftp.Rename(oldPath, newPath)
+}
@@ -2,8 +2,10 @@ package sshutils
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -28,7 +30,11 @@ const (
 
 // A Client implements an SSH client that supports running commands and scripts remotely.
 type Client struct {
-	client *ssh.Client
+	client  *ssh.Client
+	address string
+	jumps   []*ssh.Client //The connections to the jump hosts the client was connected through, first to last
+	mutex   sync.Mutex
+	ftp     *sftp.Client //Opened by the first transfer, and kept until Close
 }
 
 //Dial to remote server
@@ -38,13 +44,74 @@ func Dial(addr string, config *ssh.ClientConfig) (*Client, error) {
 		return nil, err
 	}
 	return &Client{
-		client: client,
+		client:  client,
+		address: addr,
+	}, nil
+}
+
+//Hop a jump host, an ssh server that a connection goes through to reach a host that only it can reach
+type Hop struct {
+	Address string
+	Config  *ssh.ClientConfig
+}
+
+//DialVia connect to addr through jumpHosts, like ProxyJump of OpenSSH. The first jump host is dialed directly, and
+//every other host, addr last, is dialed from the one before it
+func DialVia(jumpHosts []Hop, addr string, config *ssh.ClientConfig) (*Client, error) {
+	if len(jumpHosts) == 0 {
+		return Dial(addr, config)
+	}
+
+	var jumps = make([]*ssh.Client, 0, len(jumpHosts))
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+	hops := append(append([]Hop{}, jumpHosts...), Hop{Address: addr, Config: config})
+	var client *ssh.Client
+	for i, hop := range hops {
+		if i == 0 {
+			var err error
+			if client, err = ssh.Dial("tcp", hop.Address, hop.Config); err != nil {
+				return nil, fmt.Errorf("Failed to connect to jump host %s, %s", hop.Address, err)
+			}
+			continue
+		}
+		jumps = append(jumps, client)
+		conn, err := client.Dial("tcp", hop.Address)
+		if err != nil {
+			closeJumps()
+			return nil, fmt.Errorf("Failed to reach %s from %s, %s", hop.Address, hops[i-1].Address, err)
+		}
+		clientConn, chans, reqs, err := ssh.NewClientConn(conn, hop.Address, hop.Config)
+		if err != nil {
+			conn.Close()
+			closeJumps()
+			return nil, fmt.Errorf("Failed to connect to %s through %s, %s", hop.Address, hops[i-1].Address, err)
+		}
+		client = ssh.NewClient(clientConn, chans, reqs)
+	}
+	return &Client{
+		client:  client,
+		address: addr,
+		jumps:   jumps,
 	}, nil
 }
 
 // Close closes the underlying client network connection.
 func (c *Client) Close() error {
-	return c.client.Close()
+	c.mutex.Lock()
+	if c.ftp != nil {
+		c.ftp.Close()
+		c.ftp = nil
+	}
+	c.mutex.Unlock()
+	err := c.client.Close()
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		c.jumps[i].Close()
+	}
+	return err
 }
 
 // Cmd creates a RemoteScript that can run the command on the client. The cmd string is split on newlines and each line is executed separately.
@@ -66,8 +133,24 @@ func (c *Client) Cmd(cmd string) (stdout []byte, stderr []byte, err error) {
 	}
 	return o.Bytes(), e.Bytes(), nil
 }
-func (c *Client) newSftp() (*sftp.Client, error) {
-	return sftp.NewClient(c.client)
+
+//NewSession open a session to run a command, with its input and output under the control of the caller
+func (c *Client) NewSession() (*ssh.Session, error) {
+	return c.client.NewSession()
+}
+
+//sftp the SFTP subsystem of the connection, shared by all the transfers on it
+func (c *Client) sftp() (*sftp.Client, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.ftp == nil {
+		ftp, err := sftp.NewClient(c.client)
+		if err != nil {
+			return nil, err
+		}
+		c.ftp = ftp
+	}
+	return c.ftp, nil
 }
 
 //UploadFile upload file to remote via ftp
@@ -78,11 +161,18 @@ func (c *Client) UploadFile(localFilePath, remoteFilePath string) error {
 	}
 	defer local.Close()
 
-	ftp, err := c.newSftp()
+	ftp, err := c.sftp()
 	if err != nil {
 		return err
 	}
-	defer ftp.Close()
+
+	//A read only file is replaced too, and keeps its mode
+	if info, err := ftp.Stat(remoteFilePath); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0200 == 0 {
+		if err = ftp.Chmod(remoteFilePath, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+		defer ftp.Chmod(remoteFilePath, info.Mode().Perm())
+	}
 
 	remote, err := ftp.Create(remoteFilePath)
 	if err != nil {
@@ -96,6 +186,13 @@ func (c *Client) UploadFile(localFilePath, remoteFilePath string) error {
 
 // Download file from remote server!
 func (c *Client) Download(remoteFilePath string, localFilePath string) error {
+	//A read only file is replaced too, and keeps its mode
+	if info, err := os.Stat(localFilePath); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0200 == 0 {
+		if err = os.Chmod(localFilePath, info.Mode().Perm()|0200); err != nil {
+			return err
+		}
+		defer os.Chmod(localFilePath, info.Mode().Perm())
+	}
 
 	local, err := os.Create(localFilePath)
 	if err != nil {
@@ -103,11 +200,10 @@ func (c *Client) Download(remoteFilePath string, localFilePath string) error {
 	}
 	defer local.Close()
 
-	ftp, err := c.newSftp()
+	ftp, err := c.sftp()
 	if err != nil {
 		return err
 	}
-	defer ftp.Close()
 
 	remote, err := ftp.Open(remoteFilePath)
 	if err != nil {
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -14,75 +16,197 @@ type connectionEndpoint struct {
 }
 
 func (endpoint *connectionEndpoint) String() string {
-	return fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)
+	return net.JoinHostPort(endpoint.Host, fmt.Sprint(endpoint.Port))
 }
 
-//SSHtunnel define local remote server and remote resource to use
+//SSHtunnel define local remote server and remote resource to use. Connections to Local are forwarded to Remote
+//through the ssh connection to Server. A Reverse tunnel forwards connections to Remote, listened on by Server,
+//to Local
 type SSHtunnel struct {
-	Local  *connectionEndpoint
-	Server *connectionEndpoint
-	Remote *connectionEndpoint
-
-	Config       *ssh.ClientConfig
-	listener     net.Listener
-	stopListener bool
+	Local   *connectionEndpoint
+	Server  *connectionEndpoint
+	Remote  *connectionEndpoint
+	Reverse bool
+
+	Config    *ssh.ClientConfig
+	OnError   func(err error) //Called with the errors of forwarded connections. They are dropped if it is nil
+	client    *ssh.Client     //All the forwarded connections go through it
+	ownClient bool            //The tunnel dialed client, so it closes it
+	listener  net.Listener
+	mutex     sync.Mutex
+	conns     map[net.Conn]bool //Forwarded connections, closed with the tunnel
+	closed    bool
 }
 
-//Start listening to incomming connectiopn on local host and forward them to the remote tunnel
+//Start listening to incomming connectiopn on local host and forward them to the remote tunnel. If the local port
+//is 0, a free port is used and set to Local.Port. A Reverse tunnel listens on Remote instead, and sets Remote.Port
 func (tunnel *SSHtunnel) Start() error {
-
 	var err error
-	tunnel.listener, err = net.Listen("tcp", tunnel.Local.String())
+	if tunnel.client == nil {
+		if tunnel.client, err = ssh.Dial("tcp", tunnel.Server.String(), tunnel.Config); err != nil {
+			return err
+		}
+		tunnel.ownClient = true
+	}
+
+	if tunnel.Reverse {
+		tunnel.listener, err = tunnel.client.Listen("tcp", tunnel.Remote.String())
+	} else {
+		tunnel.listener, err = net.Listen("tcp", tunnel.Local.String())
+	}
 	if err != nil {
+		tunnel.Close()
 		return err
 	}
+	if addr, ok := tunnel.listener.Addr().(*net.TCPAddr); ok {
+		if tunnel.Reverse {
+			tunnel.Remote.Port = addr.Port
+		} else {
+			tunnel.Local.Port = addr.Port
+		}
+	}
+	tunnel.conns = make(map[net.Conn]bool)
 
 	go func() {
-		for !tunnel.stopListener {
+		for {
 			conn, err := tunnel.listener.Accept()
-			if err == nil {
-				go tunnel.forward(conn)
+			if err != nil {
+				//The listener is closed
+				return
 			}
-
+			go tunnel.forward(conn)
 		}
 	}()
 
 	return nil
 }
 
-//Close the tunnel and release any resources
+//Close the tunnel and release any resources, including the connections it forwards
 func (tunnel *SSHtunnel) Close() {
-	tunnel.stopListener = true
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.closed {
+		return
+	}
+	tunnel.closed = true
 	if tunnel.listener != nil {
 		tunnel.listener.Close()
 	}
+	for conn := range tunnel.conns {
+		conn.Close()
+	}
+	if tunnel.ownClient && tunnel.client != nil {
+		tunnel.client.Close()
+	}
+}
+
+//track add conn to the connections that are closed with the tunnel. false if the tunnel is already closed
+func (tunnel *SSHtunnel) track(conn net.Conn) bool {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	if tunnel.closed {
+		return false
+	}
+	tunnel.conns[conn] = true
+	return true
+}
+
+func (tunnel *SSHtunnel) untrack(conn net.Conn) {
+	tunnel.mutex.Lock()
+	defer tunnel.mutex.Unlock()
+	delete(tunnel.conns, conn)
 }
 
-func (tunnel *SSHtunnel) forward(localConn net.Conn) {
-	serverConn, err := ssh.Dial("tcp", tunnel.Server.String(), tunnel.Config)
+func (tunnel *SSHtunnel) forward(conn net.Conn) {
+	var target net.Conn
+	var err error
+	if tunnel.Reverse {
+		target, err = net.Dial("tcp", tunnel.Local.String())
+	} else {
+		target, err = tunnel.client.Dial("tcp", tunnel.Remote.String())
+	}
 	if err != nil {
-		fmt.Printf("Server dial error: %s\n", err)
+		if tunnel.OnError != nil {
+			tunnel.OnError(fmt.Errorf("Tunnel dial error: %v", err))
+		}
+		conn.Close()
 		return
 	}
+	pipe(conn, target, tunnel.track, tunnel.untrack)
+}
 
-	remoteConn, err := serverConn.Dial("tcp", tunnel.Remote.String())
-	if err != nil {
-		fmt.Printf("Remote dial error: %s\n", err)
+//pipe copy between two connections until either of them ends, then close both. track and untrack are told about
+//the connections while they are open
+func pipe(a, b net.Conn, track func(net.Conn) bool, untrack func(net.Conn)) {
+	if !track(a) || !track(b) {
+		a.Close()
+		b.Close()
+		untrack(a)
 		return
 	}
+	defer untrack(a)
+	defer untrack(b)
 
+	var once sync.Once
+	closeBoth := func() {
+		a.Close()
+		b.Close()
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
 	copyConn := func(writer, reader net.Conn) {
-		defer writer.Close()
-		defer reader.Close()
+		defer wg.Done()
+		io.Copy(writer, reader)
+		once.Do(closeBoth)
+	}
+	go copyConn(a, b)
+	go copyConn(b, a)
+	wg.Wait()
+}
 
-		_, err := io.Copy(writer, reader)
-		if err != nil {
-			fmt.Printf("io.Copy error: %s", err)
-		}
+//serverEndpoint the address of the server c is connected to
+func (c *Client) serverEndpoint() *connectionEndpoint {
+	server := &connectionEndpoint{Host: c.address}
+	if host, port, err := net.SplitHostPort(c.address); err == nil {
+		server.Host = host
+		server.Port, _ = strconv.Atoi(port)
 	}
+	return server
+}
 
-	go copyConn(localConn, remoteConn)
-	go copyConn(remoteConn, localConn)
+//Tunnel forward connections to localPort on the local host to remoteHost:remotePort, as the remote server sees it,
+//through the connection of c. A localPort of 0 uses a free port, which is in Local.Port of the tunnel. onError is
+//the OnError of the tunnel
+func (c *Client) Tunnel(localPort int, remoteHost string, remotePort int, onError func(err error)) (*SSHtunnel, error) {
+	tunnel := &SSHtunnel{
+		Local:   &connectionEndpoint{Host: "localhost", Port: localPort},
+		Server:  c.serverEndpoint(),
+		Remote:  &connectionEndpoint{Host: remoteHost, Port: remotePort},
+		OnError: onError,
+		client:  c.client,
+	}
+	if err := tunnel.Start(); err != nil {
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+//ReverseTunnel forward connections to remoteHost:remotePort, listened on by the remote server, to
+//localHost:localPort, as the local host sees it, through the connection of c. A remotePort of 0 uses a port the
+//server chooses, which is in Remote.Port of the tunnel. onError is the OnError of the tunnel
+func (c *Client) ReverseTunnel(remoteHost string, remotePort int, localHost string, localPort int, onError func(err error)) (*SSHtunnel, error) {
+	tunnel := &SSHtunnel{
+		Local:   &connectionEndpoint{Host: localHost, Port: localPort},
+		Server:  c.serverEndpoint(),
+		Remote:  &connectionEndpoint{Host: remoteHost, Port: remotePort},
+		Reverse: true,
+		OnError: onError,
+		client:  c.client,
+	}
+	if err := tunnel.Start(); err != nil {
+		return nil, err
+	}
+	return tunnel, nil
 }
 
 //CreateTunnel a tunnel via an intermediateServer
@@ -107,6 +231,8 @@ func CreateTunnel(localPort int, resourceHost string, resourcePort int, intermed
 		Remote: remoteEndpoint,
 	}
 
-	tunnel.Start()
+	if err := tunnel.Start(); err != nil {
+		return nil, err
+	}
 	return tunnel, nil
 }
@@ -1,53 +1,104 @@
 package sshutils
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"os"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
-//CreateFromUserPassword connect via user password
+//CreateFromUserPassword connect via user password. Set how the host key is verified, e.g. by
+//SetHostKeyVerification, before dialing
 func CreateFromUserPassword(user, pwd string) *ssh.ClientConfig {
 	return &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.Password(pwd),
 		},
-		HostKeyCallback: ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil }),
 	}
 }
 
-//CreateFromPrivateKeyContent create using private key content
+//CreateFromPrivateKeyContent create using private key content. Set how the host key is verified, e.g. by
+//SetHostKeyVerification, before dialing
 func CreateFromPrivateKeyContent(user string, privateKey []byte, passphrase ...string) (*ssh.ClientConfig, error) {
-	var signer ssh.Signer
-	var err error
-
-	if passphrase != nil && passphrase[0] != "" {
-		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase[0]))
-
-	} else {
-		signer, err = ssh.ParsePrivateKey(privateKey)
+	signer, err := privateKeySigner(privateKey, passphrase...)
+	if err != nil {
+		return nil, err
 	}
+	return CreateFromSigners(user, signer), nil
+}
 
+//CreateFromPrivateKeyFile create using private key from file
+func CreateFromPrivateKeyFile(user string, privateKeyFile string, passfphrase ...string) (*ssh.ClientConfig, error) {
+	signer, err := PrivateKeyFileSigner(privateKeyFile, passfphrase...)
 	if err != nil {
 		return nil, err
 	}
+	return CreateFromSigners(user, signer), nil
+}
 
+//CreateFromSigners create using the keys of signers, tried in order. Set how the host key is verified, e.g. by
+//SetHostKeyVerification, before dialing
+func CreateFromSigners(user string, signers ...ssh.Signer) *ssh.ClientConfig {
 	return &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
+			ssh.PublicKeys(signers...),
 		},
-		HostKeyCallback: ssh.HostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error { return nil }),
-	}, nil
+	}
 }
 
-//CreateFromPrivateKeyFile create using private key from file
-func CreateFromPrivateKeyFile(user string, privateKeyFile string, passfphrase ...string) (*ssh.ClientConfig, error) {
-	key, err := ioutil.ReadFile(privateKeyFile)
+//PrivateKeyFileSigner the signer of the private key in privateKeyFile. The error is an *ssh.PassphraseMissingError
+//if the key needs a passphrase that is not given
+func PrivateKeyFileSigner(privateKeyFile string, passphrase ...string) (ssh.Signer, error) {
+	key, err := ioutil.ReadFile(ExpandHome(privateKeyFile))
 	if err != nil {
 		return nil, err
 	}
-	return CreateFromPrivateKeyContent(user, key, passfphrase...)
+	return privateKeySigner(key, passphrase...)
+}
+
+func privateKeySigner(privateKey []byte, passphrase ...string) (ssh.Signer, error) {
+	if passphrase != nil && passphrase[0] != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase[0]))
+	}
+	return ssh.ParsePrivateKey(privateKey)
+}
+
+//AgentAvailable whether an ssh-agent is running for the user, i.e. SSH_AUTH_SOCK is set
+func AgentAvailable() bool {
+	return os.Getenv("SSH_AUTH_SOCK") != ""
+}
+
+//CreateFromAgent create using the keys of signers, e.g. of a private key file, then the keys of the running
+//ssh-agent, found by SSH_AUTH_SOCK. The agent signs while connecting, so close the returned connection to it only
+//after dialing. Set how the host key is verified, e.g. by SetHostKeyVerification, before dialing
+func CreateFromAgent(user string, signers ...ssh.Signer) (*ssh.ClientConfig, io.Closer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("No ssh-agent is running, SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot connect to ssh-agent at %s: %v", socket, err)
+	}
+	agentClient := agent.NewClient(conn)
+
+	//All the keys are in one method, since a client does not try a second method of the same kind
+	return &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				agentSigners, err := agentClient.Signers()
+				if err != nil && len(signers) == 0 {
+					return nil, err
+				}
+				return append(append([]ssh.Signer{}, signers...), agentSigners...), nil
+			}),
+		},
+	}, conn, nil
 }
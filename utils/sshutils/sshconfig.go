@@ -0,0 +1,146 @@
+package sshutils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//HostConfig the settings of a host in an OpenSSH config file. Empty fields are not set by the file
+type HostConfig struct {
+	HostName           string
+	User               string
+	Port               string
+	IdentityFile       string
+	ProxyJump          string
+	UserKnownHostsFile string
+}
+
+//DefaultConfigFile the OpenSSH config file of the user, ~/.ssh/config
+func DefaultConfigFile() string {
+	return ExpandHome("~/.ssh/config")
+}
+
+//configKeys the keywords of HostConfig, in lower case as keywords are case insensitive
+var configKeys = map[string]func(h *HostConfig) *string{
+	"hostname":           func(h *HostConfig) *string { return &h.HostName },
+	"user":               func(h *HostConfig) *string { return &h.User },
+	"port":               func(h *HostConfig) *string { return &h.Port },
+	"identityfile":       func(h *HostConfig) *string { return &h.IdentityFile },
+	"proxyjump":          func(h *HostConfig) *string { return &h.ProxyJump },
+	"userknownhostsfile": func(h *HostConfig) *string { return &h.UserKnownHostsFile },
+}
+
+//maxIncludeDepth how deep Include directives may nest, as OpenSSH does
+const maxIncludeDepth = 16
+
+//LookupHost the settings of alias in the OpenSSH config file configFile, ~/.ssh/config if it is empty. As with
+//OpenSSH, the first value found for a keyword wins. A missing ~/.ssh/config has no settings, but a missing
+//configFile is an error. Match blocks are not supported and skipped
+func LookupHost(configFile, alias string) (HostConfig, error) {
+	var host HostConfig
+	if configFile == "" {
+		configFile = DefaultConfigFile()
+		if _, e := os.Stat(configFile); os.IsNotExist(e) {
+			return host, nil
+		}
+	}
+	if e := readConfig(ExpandHome(configFile), alias, &host, 0); e != nil {
+		return host, e
+	}
+	host.HostName = strings.ReplaceAll(host.HostName, "%h", alias)
+	host.IdentityFile = ExpandHome(host.IdentityFile)
+	//Only the first of the known_hosts files is used
+	if files := strings.Fields(host.UserKnownHostsFile); len(files) > 0 {
+		host.UserKnownHostsFile = ExpandHome(files[0])
+	}
+	return host, nil
+}
+
+//readConfig set the settings of alias in configFile that host does not have yet
+func readConfig(configFile, alias string, host *HostConfig, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("SSH config %s includes too many files", configFile)
+	}
+	f, e := os.Open(configFile)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	//Lines before the first Host apply to all hosts
+	var matches = true
+	var scanner = bufio.NewScanner(f)
+	var lineNum = 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, value := splitConfigLine(scanner.Text())
+		switch keyword {
+		case "":
+			continue
+		case "host":
+			matches = matchesHost(strings.Fields(value), alias)
+		case "match":
+			matches = false
+		case "include":
+			if !matches {
+				continue
+			}
+			for _, pattern := range strings.Fields(value) {
+				pattern = ExpandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(ExpandHome("~/.ssh"), pattern)
+				}
+				files, e := filepath.Glob(pattern)
+				if e != nil {
+					return fmt.Errorf("SSH config %s line %d: %v", configFile, lineNum, e)
+				}
+				for _, file := range files {
+					if e = readConfig(file, alias, host, depth+1); e != nil {
+						return e
+					}
+				}
+			}
+		default:
+			if field, ok := configKeys[keyword]; matches && ok && *field(host) == "" {
+				*field(host) = value
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+//splitConfigLine the lower case keyword of line, and its value without quotes. Both are empty for blank lines
+//and comments
+func splitConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	var sep = strings.IndexAny(line, " \t=")
+	if sep < 0 {
+		return strings.ToLower(line), ""
+	}
+	var value = strings.TrimLeft(strings.TrimSpace(line[sep:]), "= \t")
+	if len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return strings.ToLower(line[:sep]), value
+}
+
+//matchesHost whether alias matches the patterns of a Host line. A negated pattern, !pattern, that matches
+//excludes the alias even if other patterns match it
+func matchesHost(patterns []string, alias string) bool {
+	var matched = false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		ok, _ := filepath.Match(strings.TrimPrefix(pattern, "!"), alias)
+		if ok && negated {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
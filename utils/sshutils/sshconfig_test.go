@@ -0,0 +1,150 @@
+package sshutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitConfigLine(t *testing.T) {
+	var tests = []struct {
+		line    string
+		keyword string
+		value   string
+	}{
+		{line: "", keyword: "", value: ""},
+		{line: "   ", keyword: "", value: ""},
+		{line: "# HostName example.com", keyword: "", value: ""},
+		{line: "HostName example.com", keyword: "hostname", value: "example.com"},
+		{line: "  Port\t2222", keyword: "port", value: "2222"},
+		{line: "User=deploy", keyword: "user", value: "deploy"},
+		{line: "User = deploy", keyword: "user", value: "deploy"},
+		{line: `IdentityFile "~/my keys/id_ed25519"`, keyword: "identityfile", value: "~/my keys/id_ed25519"},
+		{line: `IdentityFile "`, keyword: "identityfile", value: `"`},
+		{line: "Host web db", keyword: "host", value: "web db"},
+		{line: "Compression", keyword: "compression", value: ""},
+	}
+	for _, tt := range tests {
+		keyword, value := splitConfigLine(tt.line)
+		if keyword != tt.keyword || value != tt.value {
+			t.Errorf("splitConfigLine(%q) = %q, %q, want %q, %q", tt.line, keyword, value, tt.keyword, tt.value)
+		}
+	}
+}
+
+func TestMatchesHost(t *testing.T) {
+	var tests = []struct {
+		patterns []string
+		alias    string
+		want     bool
+	}{
+		{patterns: []string{"web"}, alias: "web", want: true},
+		{patterns: []string{"web"}, alias: "web2", want: false},
+		{patterns: []string{"*"}, alias: "web", want: true},
+		{patterns: []string{"web*"}, alias: "web2", want: true},
+		{patterns: []string{"web?"}, alias: "web12", want: false},
+		{patterns: []string{"db", "web"}, alias: "web", want: true},
+		{patterns: []string{"*", "!web"}, alias: "web", want: false},
+		{patterns: []string{"!web", "*"}, alias: "web", want: false},
+		{patterns: []string{"*", "!web"}, alias: "db", want: true},
+		{patterns: []string{"!web"}, alias: "db", want: false},
+		{patterns: nil, alias: "web", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchesHost(tt.patterns, tt.alias); got != tt.want {
+			t.Errorf("matchesHost(%q, %q) = %v, want %v", tt.patterns, tt.alias, got, tt.want)
+		}
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("No home folder")
+	}
+	dir := t.TempDir()
+	var writeFile = func(name, content string) string {
+		fileName := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return fileName
+	}
+	writeFile("included.conf", `
+Host included
+  HostName included.example.com
+  User from-include
+`)
+	configFile := writeFile("config", `
+# Applies to all hosts, and wins over later values
+IdentityFile ~/.ssh/id_default
+
+Include `+filepath.Join(dir, "*.conf")+`
+
+Host web web-*
+  HostName %h.example.com
+  User deploy
+  Port 2222
+  UserKnownHostsFile ~/.ssh/known_web /etc/ssh/known_hosts
+
+Host web
+  User ignored
+  ProxyJump bastion
+
+Host * !bastion
+  User default
+
+Match host db
+  User from-match
+
+Host db
+  HostName=10.0.0.5
+  IdentityFile ignored
+`)
+	var tests = []struct {
+		alias string
+		want  HostConfig
+	}{
+		{alias: "web", want: HostConfig{HostName: "web.example.com", User: "deploy", Port: "2222",
+			IdentityFile: filepath.Join(home, ".ssh", "id_default"), ProxyJump: "bastion",
+			UserKnownHostsFile: filepath.Join(home, ".ssh", "known_web")}},
+		{alias: "web-2", want: HostConfig{HostName: "web-2.example.com", User: "deploy", Port: "2222",
+			IdentityFile:       filepath.Join(home, ".ssh", "id_default"),
+			UserKnownHostsFile: filepath.Join(home, ".ssh", "known_web")}},
+		{alias: "db", want: HostConfig{HostName: "10.0.0.5", User: "default",
+			IdentityFile: filepath.Join(home, ".ssh", "id_default")}},
+		{alias: "bastion", want: HostConfig{IdentityFile: filepath.Join(home, ".ssh", "id_default")}},
+		{alias: "included", want: HostConfig{HostName: "included.example.com", User: "from-include",
+			IdentityFile: filepath.Join(home, ".ssh", "id_default")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			got, err := LookupHost(configFile, tt.alias)
+			if err != nil {
+				t.Fatalf("LookupHost failed: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupHost(%q) = %+v, want %+v", tt.alias, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupHostMissingFile(t *testing.T) {
+	if _, err := LookupHost(filepath.Join(t.TempDir(), "config"), "web"); err == nil {
+		t.Errorf("LookupHost of a missing config file did not fail")
+	}
+}
+
+func TestLookupHostIncludeLoop(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(configFile, []byte("Include "+configFile+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupHost(configFile, "web"); err == nil {
+		t.Errorf("LookupHost of a config that includes itself did not fail")
+	}
+}